@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+// Annotation is an event, such as a deploy or a cost anomaly, drawn as a
+// vertical marker on the daily cost chart.
+type Annotation struct {
+	// Date is the day of the event in the form of "2006-01-02".
+	Date  string `json:"date"`
+	Label string `json:"label"`
+}
+
+func validateAnnotations(annotations []Annotation) error {
+	for _, a := range annotations {
+		if _, err := time.Parse("2006-01-02", a.Date); err != nil {
+			return fmt.Errorf("invalid date of annotation %q: %w", a.Label, err)
+		}
+	}
+	return nil
+}
+
+// loadAnnotationsFile reads annotations from a JSON file of an array of
+// {"date", "label"} objects, or from a CSV file of date and label columns.
+func loadAnnotationsFile(path string) ([]Annotation, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read annotations file: %w", err)
+	}
+
+	annotations := []Annotation{}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		records, err := csv.NewReader(strings.NewReader(string(buf))).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse annotations file %s: %w", path, err)
+		}
+		for i, record := range records {
+			if len(record) < 2 {
+				return nil, fmt.Errorf("annotations file %s: line %d must have a date and a label", path, i+1)
+			}
+			// Skip the header if any.
+			if i == 0 && strings.EqualFold(record[0], "date") {
+				continue
+			}
+			annotations = append(annotations, Annotation{Date: record[0], Label: record[1]})
+		}
+	} else if err := json.Unmarshal(buf, &annotations); err != nil {
+		return nil, fmt.Errorf("failed to parse annotations file %s: %w", path, err)
+	}
+
+	if err := validateAnnotations(annotations); err != nil {
+		return nil, fmt.Errorf("annotations file %s: %w", path, err)
+	}
+	return annotations, nil
+}
+
+// getAnomalyAnnotations returns the anomalies detected by Cost Anomaly
+// Detection in the period as annotations.
+func getAnomalyAnnotations(awsConfig *aws.Config, period *types.DateInterval) ([]Annotation, error) {
+	svc := costexplorer.NewFromConfig(*awsConfig)
+	anomalies := []types.Anomaly{}
+	var token *string
+	for {
+		output, err := svc.GetAnomalies(context.TODO(), &costexplorer.GetAnomaliesInput{
+			DateInterval: &types.AnomalyDateInterval{
+				StartDate: period.Start,
+				EndDate:   period.End,
+			},
+			NextPageToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, output.Anomalies...)
+		if output.NextPageToken == nil {
+			break
+		}
+		token = output.NextPageToken
+	}
+	return anomalyAnnotations(anomalies), nil
+}
+
+func anomalyAnnotations(anomalies []types.Anomaly) []Annotation {
+	annotations := []Annotation{}
+	for _, anomaly := range anomalies {
+		date := aws.ToString(anomaly.AnomalyStartDate)
+		if len(date) < 10 {
+			continue
+		}
+		label := "Anomaly"
+		if len(anomaly.RootCauses) > 0 && anomaly.RootCauses[0].Service != nil {
+			label = "Anomaly: " + *anomaly.RootCauses[0].Service
+		} else if anomaly.DimensionValue != nil {
+			label = "Anomaly: " + *anomaly.DimensionValue
+		}
+		annotations = append(annotations, Annotation{Date: date[:10], Label: label})
+	}
+	return annotations
+}
+
+// collectAnnotations gathers the annotations of the config, the annotations
+// file and, if enabled, the anomalies in the period of the graph. A failure
+// to get anomalies does not fail the report.
+func collectAnnotations(cfg *Config, awsConfig *aws.Config, period *types.DateInterval) ([]Annotation, error) {
+	annotations := append([]Annotation{}, cfg.Annotations...)
+	if cfg.AnnotationsFile != "" {
+		fromFile, err := loadAnnotationsFile(cfg.AnnotationsFile)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, fromFile...)
+	}
+	if cfg.AnnotateAnomalies {
+		anomalies, err := getAnomalyAnnotations(awsConfig, period)
+		if err != nil {
+			slog.Error("failed to get anomalies", "error", err)
+		} else {
+			annotations = append(annotations, anomalies...)
+		}
+	}
+	return annotations, nil
+}
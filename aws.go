@@ -10,17 +10,16 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
-	"github.com/aws/aws-sdk-go-v2/service/organizations"
-	organizationTypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
 )
 
 type CostOfTwoDaysAgo struct {
+	cfg       *Config
 	awsConfig *aws.Config
 	now       time.Time
 }
 
-func NewCostOfTwoDaysAgo(awsConfig *aws.Config, now time.Time) *CostOfTwoDaysAgo {
-	return &CostOfTwoDaysAgo{awsConfig: awsConfig, now: now}
+func NewCostOfTwoDaysAgo(cfg *Config, awsConfig *aws.Config, now time.Time) *CostOfTwoDaysAgo {
+	return &CostOfTwoDaysAgo{cfg: cfg, awsConfig: awsConfig, now: now}
 }
 
 func (c *CostOfTwoDaysAgo) Period() *types.DateInterval {
@@ -34,28 +33,68 @@ func (c *CostOfTwoDaysAgo) Period() *types.DateInterval {
 
 func (c *CostOfTwoDaysAgo) GetCosts() ([]Cost, error) {
 	svc := costexplorer.NewFromConfig(*c.awsConfig)
-	period := c.Period()
-	params := &costexplorer.GetCostAndUsageInput{
-		Metrics:     []string{UnblendedCost},
-		TimePeriod:  period,
+	costAndUsage, err := svc.GetCostAndUsage(context.TODO(), c.getCostAndUsageInput())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.transformToCosts(costAndUsage)
+}
+
+// GetCostsByRegion returns the costs of the same day grouped by region only.
+func (c *CostOfTwoDaysAgo) GetCostsByRegion() ([]Cost, error) {
+	return c.getCostsByDimension(types.DimensionRegion, c.cfg.ReportFilter())
+}
+
+// GetCostsByRecordType returns the costs of the same day grouped by record
+// type only, including the credits and refunds excluded by Gross.
+func (c *CostOfTwoDaysAgo) GetCostsByRecordType() ([]Cost, error) {
+	return c.getCostsByDimension(types.DimensionRecordType, c.cfg.RecordTypeFilter())
+}
+
+func (c *CostOfTwoDaysAgo) getCostsByDimension(dimension types.Dimension, filter *types.Expression) ([]Cost, error) {
+	svc := costexplorer.NewFromConfig(*c.awsConfig)
+	input := c.getCostAndUsageInput()
+	input.Filter = filter
+	input.GroupBy = []types.GroupDefinition{
+		{
+			Type: types.GroupDefinitionTypeDimension,
+			Key:  aws.String(string(dimension)),
+		},
+	}
+	costs := []Cost{}
+	for {
+		costAndUsage, err := svc.GetCostAndUsage(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+		dimensionCosts, err := c.transformToDimensionCosts(dimension, costAndUsage.ResultsByTime)
+		if err != nil {
+			return nil, err
+		}
+		costs = append(costs, dimensionCosts...)
+		if costAndUsage.NextPageToken == nil {
+			break
+		}
+		input.NextPageToken = costAndUsage.NextPageToken
+	}
+	return costs, nil
+}
+
+func (c *CostOfTwoDaysAgo) getCostAndUsageInput() *costexplorer.GetCostAndUsageInput {
+	return &costexplorer.GetCostAndUsageInput{
+		Metrics:     []string{c.cfg.CostMetric()},
+		TimePeriod:  c.Period(),
 		Granularity: types.GranularityDaily,
+		Filter:      c.cfg.ReportFilter(),
 		GroupBy: []types.GroupDefinition{
-			{
-				Type: types.GroupDefinitionTypeDimension,
-				Key:  aws.String("LINKED_ACCOUNT"),
-			},
+			c.cfg.ReportGroupBy(),
 			{
 				Type: types.GroupDefinitionTypeDimension,
 				Key:  aws.String("SERVICE"),
 			},
 		},
 	}
-	costAndUsage, err := svc.GetCostAndUsage(context.TODO(), params)
-	if err != nil {
-		return nil, err
-	}
-
-	return c.transformToCosts(costAndUsage)
 }
 
 func (c *CostOfTwoDaysAgo) transformToCosts(costAndUsage *costexplorer.GetCostAndUsageOutput) ([]Cost, error) {
@@ -66,29 +105,58 @@ func (c *CostOfTwoDaysAgo) transformToCosts(costAndUsage *costexplorer.GetCostAn
 		linkedAccounts[*value.Value] = value.Attributes["description"]
 	}
 
+	metric := c.cfg.CostMetric()
+	groupBy := c.cfg.ReportGroupBy()
 	costs := []Cost{}
 	for _, value := range costAndUsage.ResultsByTime {
 		for _, group := range value.Groups {
-			accountName := linkedAccounts[group.Keys[0]]
+			accountName := groupLabel(groupBy, group.Keys[0], linkedAccounts)
 			serviceName := group.Keys[1]
-			amount, err := strconv.ParseFloat(*group.Metrics["UnblendedCost"].Amount, 64)
+			amount, err := strconv.ParseFloat(*group.Metrics[metric].Amount, 64)
 			if err != nil {
 				return nil, err
 			}
-			costs = append(costs, Cost{AccountName: accountName, ServiceName: serviceName, Amount: amount})
+			cost := Cost{AccountName: accountName, ServiceName: serviceName, Amount: amount, Estimated: value.Estimated}
+			if isLinkedAccount(groupBy) {
+				cost.AccountId = group.Keys[0]
+			}
+			costs = append(costs, cost)
 		}
 	}
 
 	return costs, nil
 }
 
+func (c *CostOfTwoDaysAgo) transformToDimensionCosts(dimension types.Dimension, results []types.ResultByTime) ([]Cost, error) {
+	metric := c.cfg.CostMetric()
+	costs := []Cost{}
+	for _, value := range results {
+		for _, group := range value.Groups {
+			amount, err := strconv.ParseFloat(*group.Metrics[metric].Amount, 64)
+			if err != nil {
+				return nil, err
+			}
+			cost := Cost{Amount: amount, Estimated: value.Estimated}
+			switch dimension {
+			case types.DimensionRegion:
+				cost.Region = group.Keys[0]
+			case types.DimensionRecordType:
+				cost.RecordType = group.Keys[0]
+			}
+			costs = append(costs, cost)
+		}
+	}
+	return costs, nil
+}
+
 type ForecastsOfCurrentMonth struct {
+	cfg       *Config
 	awsConfig *aws.Config
 	now       time.Time
 }
 
-func NewForecastsOfCurrentMonth(awsConfig *aws.Config, now time.Time) *ForecastsOfCurrentMonth {
-	return &ForecastsOfCurrentMonth{awsConfig: awsConfig, now: now}
+func NewForecastsOfCurrentMonth(cfg *Config, awsConfig *aws.Config, now time.Time) *ForecastsOfCurrentMonth {
+	return &ForecastsOfCurrentMonth{cfg: cfg, awsConfig: awsConfig, now: now}
 }
 
 func (f *ForecastsOfCurrentMonth) Period() *types.DateInterval {
@@ -98,15 +166,6 @@ func (f *ForecastsOfCurrentMonth) Period() *types.DateInterval {
 	}
 }
 
-func (f *ForecastsOfCurrentMonth) getAccountIds() ([]organizationTypes.Account, error) {
-	organizationSvc := organizations.NewFromConfig(*f.awsConfig)
-	listAccountOutput, err := organizationSvc.ListAccounts(context.TODO(), &organizations.ListAccountsInput{})
-	if err != nil {
-		return nil, err
-	}
-	return listAccountOutput.Accounts, err
-}
-
 func (f *ForecastsOfCurrentMonth) GetForecasts() (map[string]float64, error) {
 	period := f.Period()
 
@@ -118,7 +177,7 @@ func (f *ForecastsOfCurrentMonth) GetForecasts() (map[string]float64, error) {
 	forecasts := make(map[string]float64)
 	configSvc := costexplorer.NewFromConfig(*f.awsConfig)
 
-	accounts, err := f.getAccountIds()
+	groups, err := listGroups(f.cfg, f.awsConfig, f.now)
 	if err != nil {
 		return nil, err
 	}
@@ -127,27 +186,17 @@ func (f *ForecastsOfCurrentMonth) GetForecasts() (map[string]float64, error) {
 	forecastsChan := make(chan struct {
 		name   string
 		amount float64
-	}, len(accounts))
-	errChan := make(chan error, len(accounts))
+	}, len(groups))
+	errChan := make(chan error, len(groups))
 
-	for _, account := range accounts {
+	for _, group := range groups {
 		wg.Add(1)
-		go func(account organizationTypes.Account) {
+		go func(group Group) {
 			defer wg.Done()
-			params := &costexplorer.GetCostForecastInput{
-				Granularity: types.GranularityMonthly,
-				Metric:      "UNBLENDED_COST",
-				TimePeriod:  period,
-				Filter: &types.Expression{
-					Dimensions: &types.DimensionValues{
-						Key:    "LINKED_ACCOUNT",
-						Values: []string{*account.Id},
-					},
-				},
-			}
+			params := f.getCostForecastInput(group)
 			costForecast, err := configSvc.GetCostForecast(context.TODO(), params)
 			if err != nil {
-				slog.Error("unable to get cost forecast for %s, %v\n", *account.Id, err)
+				slog.Error("unable to get cost forecast", "group", group.Name, "error", err)
 				return
 			}
 			if costForecast != nil {
@@ -159,9 +208,9 @@ func (f *ForecastsOfCurrentMonth) GetForecasts() (map[string]float64, error) {
 				forecastsChan <- struct {
 					name   string
 					amount float64
-				}{*account.Name, amount}
+				}{group.Name, amount}
 			}
-		}(account)
+		}(group)
 	}
 
 	go func() {
@@ -180,17 +229,38 @@ func (f *ForecastsOfCurrentMonth) GetForecasts() (map[string]float64, error) {
 	return forecasts, nil
 }
 
+func (f *ForecastsOfCurrentMonth) getCostForecastInput(group Group) *costexplorer.GetCostForecastInput {
+	return &costexplorer.GetCostForecastInput{
+		Granularity: types.GranularityMonthly,
+		Metric:      forecastMetrics[f.cfg.CostMetric()],
+		TimePeriod:  f.Period(),
+		Filter:      andFilters(group.Filter, f.cfg.ReportFilter()),
+	}
+}
+
 type CostGraphRenderer struct {
 	cfg       *Config
 	awsConfig *aws.Config
 	now       time.Time
+	history   *CostHistory
 }
 
 func NewCostGraphRenderer(cfg *Config, awsConfig *aws.Config, now time.Time) *CostGraphRenderer {
 	return &CostGraphRenderer{cfg: cfg, awsConfig: awsConfig, now: now}
 }
 
+// WithHistory makes the renderer read the finalized daily costs from the
+// history instead of fetching them again.
+func (c *CostGraphRenderer) WithHistory(history *CostHistory) *CostGraphRenderer {
+	c.history = history
+	return c
+}
+
+// Period returns the window of the graph, which defaults to the last 3 months.
 func (c *CostGraphRenderer) Period() *types.DateInterval {
+	if c.cfg.GetCostAndUsageInput != nil && c.cfg.GetCostAndUsageInput.TimePeriod != nil {
+		return c.cfg.GetCostAndUsageInput.TimePeriod
+	}
 	start := c.now.AddDate(0, -3, 0).Format("2006-01-02")
 	end := c.now.AddDate(0, 0, -1).Format("2006-01-02")
 	return &types.DateInterval{
@@ -199,18 +269,141 @@ func (c *CostGraphRenderer) Period() *types.DateInterval {
 	}
 }
 
-func (c *CostGraphRenderer) GetCosts() ([]organizationTypes.Account, []DailyCosts, error) {
+func (c *CostGraphRenderer) GetCosts() ([]DailyCosts, error) {
+	return c.getCosts(c.getCostAndUsageInput())
+}
+
+// GetCostsByService returns daily costs over the same window as GetCosts,
+// grouped by service instead.
+func (c *CostGraphRenderer) GetCostsByService() ([]DailyCosts, error) {
+	input := c.getCostAndUsageInput()
+	input.GroupBy = []types.GroupDefinition{
+		{
+			Type: types.GroupDefinitionTypeDimension,
+			Key:  aws.String("SERVICE"),
+		},
+	}
+	return c.getCosts(input)
+}
+
+// GetCostsByRegion returns daily costs over the same window as GetCosts,
+// grouped by region instead.
+func (c *CostGraphRenderer) GetCostsByRegion() ([]DailyCosts, error) {
+	input := c.getCostAndUsageInput()
+	input.GroupBy = []types.GroupDefinition{
+		{
+			Type: types.GroupDefinitionTypeDimension,
+			Key:  aws.String(string(types.DimensionRegion)),
+		},
+	}
+	return c.getCosts(input)
+}
+
+// Month returns the first day of the month of the last actual day in the
+// graph, which is the current month of the cumulative chart.
+func (c *CostGraphRenderer) Month() time.Time {
+	last := c.now.AddDate(0, 0, -2)
+	return time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetCostsOfMonthLastYear returns the daily costs of the same month as Month
+// a year before, which is outside of the window of GetCosts.
+func (c *CostGraphRenderer) GetCostsOfMonthLastYear() ([]DailyCosts, error) {
+	month := c.Month().AddDate(-1, 0, 0)
+	input := c.getCostAndUsageInput()
+	input.Granularity = types.GranularityDaily
+	input.TimePeriod = &types.DateInterval{
+		Start: aws.String(month.Format("2006-01-02")),
+		End:   aws.String(month.AddDate(0, 1, 0).Format("2006-01-02")),
+	}
+	return c.getCosts(input)
+}
+
+// EndsAtLatestDay tells whether the graph window runs up to the latest day
+// with costs, so that the forecast can follow it.
+func (c *CostGraphRenderer) EndsAtLatestDay() bool {
+	return *c.Period().End >= c.now.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+// ForecastPeriod returns the rest of the current month from today, which is
+// the window of the forecast drawn after the actual costs.
+func (c *CostGraphRenderer) ForecastPeriod() *types.DateInterval {
+	return &types.DateInterval{
+		Start: aws.String(c.now.Format("2006-01-02")),
+		End:   aws.String(time.Date(c.now.Year(), c.now.Month()+1, 1, 0, 0, 0, 0, time.Local).Format("2006-01-02")),
+	}
+}
+
+// GetForecast returns the daily forecast of the total costs for the rest of
+// the current month, with the bounds of its prediction interval.
+func (c *CostGraphRenderer) GetForecast() ([]DailyForecast, error) {
+	period := c.ForecastPeriod()
+	if *period.Start == *period.End {
+		return nil, nil
+	}
+
+	svc := costexplorer.NewFromConfig(*c.awsConfig)
+	costForecast, err := svc.GetCostForecast(context.TODO(), &costexplorer.GetCostForecastInput{
+		Granularity:             types.GranularityDaily,
+		Metric:                  forecastMetrics[c.cfg.CostMetric()],
+		TimePeriod:              period,
+		Filter:                  c.cfg.ReportFilter(),
+		PredictionIntervalLevel: aws.Int32(ForecastPredictionIntervalLevel),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transformToForecasts(costForecast.ForecastResultsByTime)
+}
+
+func transformToForecasts(results []types.ForecastResult) ([]DailyForecast, error) {
+	forecasts := []DailyForecast{}
+	for _, result := range results {
+		date, err := time.Parse("2006-01-02", *result.TimePeriod.Start)
+		if err != nil {
+			return nil, err
+		}
+		f := DailyForecast{Date: &date}
+		for _, v := range []struct {
+			value *string
+			dest  *float64
+		}{
+			{result.MeanValue, &f.Mean},
+			{result.PredictionIntervalLowerBound, &f.Lower},
+			{result.PredictionIntervalUpperBound, &f.Upper},
+		} {
+			if v.value == nil {
+				continue
+			}
+			amount, err := strconv.ParseFloat(*v.value, 64)
+			if err != nil {
+				return nil, err
+			}
+			*v.dest = amount
+		}
+		forecasts = append(forecasts, f)
+	}
+	return forecasts, nil
+}
+
+func (c *CostGraphRenderer) getCosts(input *costexplorer.GetCostAndUsageInput) ([]DailyCosts, error) {
+	if c.history != nil && input.Granularity == types.GranularityDaily {
+		return c.history.DailyCosts(input, c.fetchCosts)
+	}
+	return c.fetchCosts(input)
+}
+
+func (c *CostGraphRenderer) fetchCosts(input *costexplorer.GetCostAndUsageInput) ([]DailyCosts, error) {
 	svc := costexplorer.NewFromConfig(*c.awsConfig)
 	results := []types.ResultByTime{}
 	dimensionValueAttributes := []types.DimensionValuesWithAttributes{}
 	var token *string
-	input := c.getCostAndUsageInput()
 
 	for {
 		input.NextPageToken = token
 		costAndUsage, err := svc.GetCostAndUsage(context.TODO(), input)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		dimensionValueAttributes = append(dimensionValueAttributes, costAndUsage.DimensionValueAttributes...)
 		results = append(results, costAndUsage.ResultsByTime...)
@@ -220,48 +413,40 @@ func (c *CostGraphRenderer) GetCosts() ([]organizationTypes.Account, []DailyCost
 		token = costAndUsage.NextPageToken
 	}
 
-	accounts, err := c.getAccountIds()
-	if err != nil {
-		return nil, nil, err
-	}
-	costs, err := c.transformToCosts(dimensionValueAttributes, results)
-	if err != nil {
-		return nil, nil, err
-	}
-	return accounts, costs, nil
+	return c.transformToCosts(input.GroupBy[0], dimensionValueAttributes, results)
 }
 
-func (c *CostGraphRenderer) getAccountIds() ([]organizationTypes.Account, error) {
-	organizationSvc := organizations.NewFromConfig(*c.awsConfig)
-	listAccountOutput, err := organizationSvc.ListAccounts(context.TODO(), &organizations.ListAccountsInput{})
-	if err != nil {
-		return nil, err
-	}
-	return listAccountOutput.Accounts, err
-}
-
-func (c *CostGraphRenderer) transformToCosts(dimensionValueAttributes []types.DimensionValuesWithAttributes, results []types.ResultByTime) ([]DailyCosts, error) {
+func (c *CostGraphRenderer) transformToCosts(groupBy types.GroupDefinition, dimensionValueAttributes []types.DimensionValuesWithAttributes, results []types.ResultByTime) ([]DailyCosts, error) {
 	linkedAccounts := map[string]string{}
 	for _, value := range dimensionValueAttributes {
 		linkedAccounts[*value.Value] = value.Attributes["description"]
 	}
-	input := c.getCostAndUsageInput()
+	metric := c.cfg.CostMetric()
+	byService := groupBy.Type == types.GroupDefinitionTypeDimension && aws.ToString(groupBy.Key) == "SERVICE"
+	byRegion := groupBy.Type == types.GroupDefinitionTypeDimension && aws.ToString(groupBy.Key) == string(types.DimensionRegion)
 
 	costs := []DailyCosts{}
 	for _, value := range results {
-		parsed, err := time.Parse("2006-01-02", *value.TimePeriod.End)
+		parsed, err := time.Parse("2006-01-02", *value.TimePeriod.Start)
 		if err != nil {
 			return nil, err
 		}
-		c := DailyCosts{Date: &parsed, Costs: []Cost{}}
+		c := DailyCosts{Date: &parsed, Costs: []Cost{}, Estimated: value.Estimated}
 		for _, group := range value.Groups {
-			accountName := linkedAccounts[group.Keys[0]]
-			for _, metric := range input.Metrics {
-				amount, err := strconv.ParseFloat(*group.Metrics[metric].Amount, 64)
-				if err != nil {
-					return nil, err
+			amount, err := strconv.ParseFloat(*group.Metrics[metric].Amount, 64)
+			if err != nil {
+				return nil, err
+			}
+			if byService {
+				c.Costs = append(c.Costs, Cost{ServiceName: group.Keys[0], Amount: amount, Estimated: value.Estimated})
+			} else if byRegion {
+				c.Costs = append(c.Costs, Cost{Region: group.Keys[0], Amount: amount, Estimated: value.Estimated})
+			} else {
+				cost := Cost{AccountName: groupLabel(groupBy, group.Keys[0], linkedAccounts), Amount: amount, Estimated: value.Estimated}
+				if isLinkedAccount(groupBy) {
+					cost.AccountId = group.Keys[0]
 				}
-				c.Costs = append(c.Costs, Cost{AccountName: accountName, Amount: amount})
+				c.Costs = append(c.Costs, cost)
 			}
 		}
 		costs = append(costs, c)
@@ -272,40 +457,38 @@ func (c *CostGraphRenderer) transformToCosts(dimensionValueAttributes []types.Di
 
 func (c *CostGraphRenderer) getCostAndUsageInput() *costexplorer.GetCostAndUsageInput {
 	defaultInput := &costexplorer.GetCostAndUsageInput{
-		Metrics:     []string{UnblendedCost},
+		Metrics:     []string{c.cfg.CostMetric()},
 		TimePeriod:  c.Period(),
 		Granularity: types.GranularityDaily,
-		Filter: &types.Expression{
-			Not: &types.Expression{
-				Dimensions: &types.DimensionValues{
-					Key:    types.DimensionService,
-					Values: []string{"Tax"},
-				},
-			},
-		},
-		GroupBy: []types.GroupDefinition{
-			{
-				Type: types.GroupDefinitionTypeDimension,
-				Key:  aws.String("LINKED_ACCOUNT"),
-			},
-		},
+		Filter:      c.cfg.ReportFilter(),
+		GroupBy:     []types.GroupDefinition{c.cfg.ReportGroupBy()},
+	}
+	// Weekly costs are summed from daily costs when drawing.
+	if c.cfg.GraphGranularity() == types.GranularityMonthly {
+		defaultInput.Granularity = types.GranularityMonthly
 	}
 	if c.cfg.GetCostAndUsageInput != nil {
-		if c.cfg.GetCostAndUsageInput.Metrics != nil {
-			defaultInput.Metrics = c.cfg.GetCostAndUsageInput.Metrics
-		}
-		if c.cfg.GetCostAndUsageInput.TimePeriod != nil {
-			defaultInput.TimePeriod = c.cfg.GetCostAndUsageInput.TimePeriod
-		}
-		if c.cfg.GetCostAndUsageInput.Granularity != "" {
-			defaultInput.Granularity = c.cfg.GetCostAndUsageInput.Granularity
-		}
-		if c.cfg.GetCostAndUsageInput.Filter != nil {
-			defaultInput.Filter = c.cfg.GetCostAndUsageInput.Filter
-		}
-		if c.cfg.GetCostAndUsageInput.GroupBy != nil {
+		if c.cfg.GroupBy == nil && c.cfg.GetCostAndUsageInput.GroupBy != nil {
 			defaultInput.GroupBy = c.cfg.GetCostAndUsageInput.GroupBy
 		}
 	}
 	return defaultInput
 }
+
+// andFilters combines the non-nil expressions with And.
+func andFilters(exprs ...*types.Expression) *types.Expression {
+	filters := []types.Expression{}
+	for _, expr := range exprs {
+		if expr != nil {
+			filters = append(filters, *expr)
+		}
+	}
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return &filters[0]
+	default:
+		return &types.Expression{And: filters}
+	}
+}
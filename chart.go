@@ -0,0 +1,831 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"image/color"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+	"gonum.org/v1/plot/vg/vgpdf"
+	"gonum.org/v1/plot/vg/vgsvg"
+)
+
+const (
+	ChartAccount = "account"
+	ChartService = "service"
+	// ChartCumulative compares the month-to-date costs of the current month,
+	// the previous month and the same month last year.
+	ChartCumulative = "cumulative"
+	// ChartAccountLine draws the daily costs of each account as a line.
+	ChartAccountLine = "account_line"
+	// ChartHeatmap draws the daily costs as a calendar of weeks and weekdays.
+	ChartHeatmap = "heatmap"
+	// ChartRegion stacks the daily costs by region.
+	ChartRegion = "region"
+
+	// OthersLabel is the series the costs outside of the top N are merged into.
+	OthersLabel = "Others"
+
+	DefaultTopServices = 10
+
+	ChartFormatPNG = "png"
+	ChartFormatSVG = "svg"
+	ChartFormatPDF = "pdf"
+
+	// ChartTargetSlack and ChartTargetFile are the delivery targets of
+	// charts: the Slack upload and the files written on a dry run.
+	ChartTargetSlack = "slack"
+	ChartTargetFile  = "file"
+
+	DefaultChartWidth  = 1000
+	DefaultChartHeight = 300
+	DefaultChartDPI    = 96
+)
+
+var chartFormats = []string{
+	ChartFormatPNG,
+	ChartFormatSVG,
+	ChartFormatPDF,
+}
+
+var chartTargets = []string{
+	ChartTargetSlack,
+	ChartTargetFile,
+}
+
+var chartNames = []string{
+	ChartAccount,
+	ChartService,
+	ChartCumulative,
+	ChartAccountLine,
+	ChartHeatmap,
+	ChartRegion,
+}
+
+// Chart is a rendered chart image.
+type Chart struct {
+	Name     string
+	Filename string
+	// Comment is posted along with the image.
+	Comment string
+	Buffer  *bytes.Buffer
+}
+
+// ChartImage configures the format and size of chart images.
+type ChartImage struct {
+	// Format is "png", "svg" or "pdf". Defaults to "png".
+	Format string
+	// Width and Height are in points (1/72 inch). Default to 1000x300.
+	Width  float64
+	Height float64
+	// DPI is the resolution of PNG images. Defaults to 96.
+	DPI int
+}
+
+func (i ChartImage) withDefaults() ChartImage {
+	if i.Format == "" {
+		i.Format = ChartFormatPNG
+	}
+	if i.Width == 0 {
+		i.Width = DefaultChartWidth
+	}
+	if i.Height == 0 {
+		i.Height = DefaultChartHeight
+	}
+	if i.DPI == 0 {
+		i.DPI = DefaultChartDPI
+	}
+	return i
+}
+
+// newCanvas returns a canvas of the format and size of the image.
+func (i ChartImage) newCanvas() (vg.CanvasWriterTo, error) {
+	i = i.withDefaults()
+	w, h := vg.Length(i.Width), vg.Length(i.Height)
+	switch i.Format {
+	case ChartFormatPNG:
+		return vgimg.PngCanvas{Canvas: vgimg.NewWith(vgimg.UseWH(w, h), vgimg.UseDPI(i.DPI))}, nil
+	case ChartFormatSVG:
+		return vgsvg.New(w, h), nil
+	case ChartFormatPDF:
+		return vgpdf.New(w, h), nil
+	default:
+		return nil, fmt.Errorf("unknown chart format %q: must be one of %s", i.Format, strings.Join(chartFormats, ", "))
+	}
+}
+
+func validateChartImages(images map[string]ChartImage) error {
+	for target, image := range images {
+		found := false
+		for _, t := range chartTargets {
+			if t == target {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown chart target %q: must be one of %s", target, strings.Join(chartTargets, ", "))
+		}
+		if image.Width < 0 || image.Height < 0 || image.DPI < 0 {
+			return fmt.Errorf("chart size of %s must not be negative", target)
+		}
+		if _, err := image.newCanvas(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type chartOptions struct {
+	Title    string
+	Colors   []color.Color
+	Currency *Currency
+	// Granularity is the period of a bar or point of the stacked bar and
+	// line charts. Weekly costs are summed from the daily costs.
+	Granularity types.Granularity
+	// SeriesName returns the series a cost is stacked in.
+	SeriesName func(Cost) string
+	// SeriesColors are colors of specific series, keyed by the series name or
+	// the account id.
+	SeriesColors map[string]color.Color
+	Image        ChartImage
+	// Forecasts are drawn after the last actual day.
+	Forecasts []DailyForecast
+	// Account restricts the heatmap to the account (or group) of the name or
+	// id. Empty means the total of all accounts.
+	Account string
+	// Annotations are drawn as vertical markers on the stacked bar charts.
+	Annotations []Annotation
+	// Month is the current month of the cumulative chart.
+	Month time.Time
+	// Limit is the number of series drawn. The others are merged into
+	// OthersLabel. Zero means as many series as there are colors.
+	Limit int
+}
+
+func accountSeries(c Cost) string {
+	return c.AccountName
+}
+
+func serviceSeries(c Cost) string {
+	return c.ServiceName
+}
+
+func regionSeries(c Cost) string {
+	return c.Region
+}
+
+func validateCharts(names []string) error {
+	for _, name := range names {
+		found := false
+		for _, n := range chartNames {
+			if n == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown chart %q", name)
+		}
+	}
+	return nil
+}
+
+// chartSeries returns the names of the series in the order of the name, and
+// a map from the name of a cost to its series. When there are more series
+// than limit, the smallest ones over the whole window are merged into
+// OthersLabel.
+func chartSeries(dailyCosts []DailyCosts, seriesName func(Cost) string, limit int) ([]string, map[string]string) {
+	totals := map[string]float64{}
+	for _, dailyCost := range dailyCosts {
+		for _, cost := range dailyCost.Costs {
+			totals[seriesName(cost)] += cost.Amount
+		}
+	}
+	names := sortedKeys(totals)
+
+	seriesOf := map[string]string{}
+	for _, name := range names {
+		seriesOf[name] = name
+	}
+	if limit <= 0 || len(names) <= limit {
+		return names, seriesOf
+	}
+
+	ranked := make([]string, len(names))
+	copy(ranked, names)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return totals[ranked[i]] > totals[ranked[j]]
+	})
+	for _, name := range ranked[limit:] {
+		seriesOf[name] = OthersLabel
+	}
+	top := ranked[:limit]
+	sort.Strings(top)
+	return append(top, OthersLabel), seriesOf
+}
+
+// OthersColor is the color of the OthersLabel series.
+var OthersColor = color.Gray{Y: 0xb0}
+
+// ForecastColor and ForecastBandColor are translucent so that the forecast is
+// told apart from the actual costs.
+var (
+	ForecastColor     = color.NRGBA{R: 0x40, G: 0x40, B: 0x40, A: 0x60}
+	ForecastBandColor = color.NRGBA{R: 0x40, G: 0x40, B: 0x40, A: 0x20}
+)
+
+// defaultSeriesLimit returns a limit merging the smallest series into
+// OthersLabel when there are more series than colors.
+func defaultSeriesLimit(dailyCosts []DailyCosts, seriesName func(Cost) string, numColors int) int {
+	names, _ := chartSeries(dailyCosts, seriesName, 0)
+	if len(names) <= numColors {
+		return 0
+	}
+	return max(numColors-1, 1)
+}
+
+// seriesIds returns the account id of each series, if the series is an account.
+func seriesIds(dailyCosts []DailyCosts, seriesName func(Cost) string) map[string]string {
+	ids := map[string]string{}
+	for _, dailyCost := range dailyCosts {
+		for _, cost := range dailyCost.Costs {
+			if cost.AccountId != "" {
+				ids[seriesName(cost)] = cost.AccountId
+			}
+		}
+	}
+	return ids
+}
+
+// seriesColors assigns a color to each series. Colors configured for the
+// series name or account id are used first. Otherwise the color is picked
+// by a hash of the account id (or the name) alone, so that a series keeps its
+// color across days, runs and charts regardless of the other series. Two
+// series may share a color when their hashes collide.
+func seriesColors(names []string, ids map[string]string, colors []color.Color, configured map[string]color.Color) map[string]color.Color {
+	assigned := map[string]color.Color{}
+	for _, name := range names {
+		key := name
+		if id, ok := ids[name]; ok {
+			key = id
+		}
+		if c, ok := configured[name]; ok {
+			assigned[name] = c
+		} else if c, ok := configured[key]; ok {
+			assigned[name] = c
+		} else if name == OthersLabel {
+			assigned[name] = OthersColor
+		} else {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			assigned[name] = colors[h.Sum32()%uint32(len(colors))]
+		}
+	}
+	return assigned
+}
+
+func generateSeriesColors(colorConfig map[string]string) (map[string]color.Color, error) {
+	colors := map[string]color.Color{}
+	for key, hex := range colorConfig {
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid color of %s: %w", key, err)
+		}
+		colors[key] = c
+	}
+	return colors, nil
+}
+
+// periodDays returns the first and the last days of the period, whose end is
+// exclusive, formatted for the graph comments.
+func periodDays(period *types.DateInterval) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01-02", aws.ToString(period.Start))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := time.Parse("2006-01-02", aws.ToString(period.End))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end.AddDate(0, 0, -1), nil
+}
+
+// renderCharts renders the configured charts in the image format of the
+// delivery target.
+func renderCharts(cfg *Config, messages *Messages, currency *Currency, period *types.DateInterval, report *Report, target string) ([]Chart, error) {
+	colors, err := generateColors(cfg.Colors)
+	if err != nil {
+		return nil, err
+	}
+	seriesColors, err := generateSeriesColors(cfg.AccountColors)
+	if err != nil {
+		return nil, err
+	}
+
+	image := cfg.ChartImage(target)
+	granularity := cfg.GraphGranularity()
+	title := granularityTitles[granularity]
+	metric := report.metricLabel()
+	first, last, err := periodDays(period)
+	if err != nil {
+		return nil, err
+	}
+	from, to := messages.FormatDate(first), messages.FormatDate(last)
+	periodLabel := "3 months"
+	if cfg.GetCostAndUsageInput != nil && cfg.GetCostAndUsageInput.TimePeriod != nil {
+		periodLabel = fmt.Sprintf("%s to %s", *period.Start, *period.End)
+	}
+	charts := []Chart{}
+	for _, name := range cfg.ChartNames() {
+		opts := chartOptions{
+			Granularity:  granularity,
+			Colors:       colors,
+			SeriesColors: seriesColors,
+			Currency:     currency,
+			Annotations:  report.Annotations,
+			Image:        image,
+		}
+		var chart Chart
+		var dailyCosts []DailyCosts
+		drawChart := drawStackedBarChart
+		switch name {
+		case ChartAccount:
+			opts.Title = fmt.Sprintf("AWS %s Costs (%s, %s)", title, periodLabel, metric)
+			opts.SeriesName = accountSeries
+			opts.Limit = cfg.TopSeries
+			opts.Forecasts = report.DailyForecasts
+			dailyCosts = report.DailyCosts
+			chart = Chart{Name: name, Filename: "daily_costs." + image.Format, Comment: messages.Text("graph_comment", from, to)}
+		case ChartService:
+			opts.Title = fmt.Sprintf("AWS %s Costs by Service (%s, %s)", title, periodLabel, metric)
+			opts.SeriesName = serviceSeries
+			opts.Limit = cfg.TopServices
+			if opts.Limit == 0 {
+				opts.Limit = DefaultTopServices
+			}
+			dailyCosts = report.ServiceDailyCosts
+			chart = Chart{Name: name, Filename: "daily_costs_by_service." + image.Format, Comment: messages.Text("graph_comment_service", from, to)}
+		case ChartRegion:
+			opts.Title = fmt.Sprintf("AWS %s Costs by Region (%s, %s)", title, periodLabel, metric)
+			opts.SeriesName = regionSeries
+			dailyCosts = report.RegionDailyCosts
+			chart = Chart{Name: name, Filename: "daily_costs_by_region." + image.Format, Comment: messages.Text("graph_comment_region", from, to)}
+		case ChartCumulative:
+			opts.Title = fmt.Sprintf("AWS Cumulative Month-to-Date Costs (%s)", metric)
+			opts.Month = report.Month
+			dailyCosts = append(append([]DailyCosts{}, report.DailyCosts...), report.LastYearDailyCosts...)
+			drawChart = drawCumulativeChart
+			chart = Chart{Name: name, Filename: "cumulative_costs." + image.Format, Comment: messages.Text("graph_comment_cumulative")}
+		case ChartAccountLine:
+			opts.Title = fmt.Sprintf("AWS %s Costs by Account (%s, %s)", title, periodLabel, metric)
+			opts.SeriesName = accountSeries
+			opts.Limit = cfg.TopSeries
+			dailyCosts = report.DailyCosts
+			drawChart = drawLineChart
+			chart = Chart{Name: name, Filename: "daily_costs_line." + image.Format, Comment: messages.Text("graph_comment_line", from, to)}
+		case ChartHeatmap:
+			opts.Title = fmt.Sprintf("AWS Daily Costs by Weekday (%s, %s)", periodLabel, metric)
+			if cfg.HeatmapAccount != "" {
+				opts.Title = fmt.Sprintf("AWS Daily Costs of %s by Weekday (%s, %s)", cfg.HeatmapAccount, periodLabel, metric)
+			}
+			opts.Account = cfg.HeatmapAccount
+			dailyCosts = report.DailyCosts
+			drawChart = drawHeatmap
+			chart = Chart{Name: name, Filename: "daily_costs_heatmap." + image.Format, Comment: messages.Text("graph_comment_heatmap", from, to)}
+		}
+		buf, err := drawChart(opts, dailyCosts)
+		if err != nil && name == ChartHeatmap {
+			// The heatmap is an extra image, so the other charts are posted
+			// without it.
+			slog.Error("failed to draw heatmap", "error", err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to draw %s chart: %w", name, err)
+		}
+		chart.Buffer = buf
+		charts = append(charts, chart)
+	}
+	return charts, nil
+}
+
+// drawLineChart draws the daily costs of each series as a line, to compare
+// the trends of the accounts rather than their share of the total.
+func drawLineChart(opts chartOptions, dailyCosts []DailyCosts) (*bytes.Buffer, error) {
+	p := newChartPlot(opts)
+	p.Y.Min = 0
+	dailyCosts = aggregateCosts(dailyCosts, opts.Granularity)
+	limit := opts.Limit
+	if limit == 0 {
+		limit = defaultSeriesLimit(dailyCosts, opts.SeriesName, len(opts.Colors))
+	}
+	names, seriesOf := chartSeries(dailyCosts, opts.SeriesName, limit)
+	colors := seriesColors(names, seriesIds(dailyCosts, opts.SeriesName), opts.Colors, opts.SeriesColors)
+
+	points := map[string]plotter.XYs{}
+	for i, dailyCost := range dailyCosts {
+		amounts := map[string]float64{}
+		for _, cost := range dailyCost.Costs {
+			amounts[seriesOf[opts.SeriesName(cost)]] += cost.Amount
+		}
+		for _, name := range names {
+			points[name] = append(points[name], plotter.XY{X: float64(i), Y: amounts[name]})
+		}
+	}
+	p.NominalX(periodLabels(dailyCosts, opts.Granularity)...)
+
+	l := newLegend(p)
+	for _, name := range names {
+		line, err := plotter.NewLine(points[name])
+		if err != nil {
+			return nil, err
+		}
+		line.Color = colors[name]
+		p.Add(line)
+		l.Add(name, line)
+	}
+	return writeChart(p, l, opts.Image)
+}
+
+// cumulativeCosts returns the running total of the costs of the month by day
+// of the month.
+func cumulativeCosts(dailyCosts []DailyCosts, month time.Time) plotter.XYs {
+	xys := plotter.XYs{}
+	total := 0.0
+	for _, dailyCost := range dailyCosts {
+		if dailyCost.Date.Year() != month.Year() || dailyCost.Date.Month() != month.Month() {
+			continue
+		}
+		for _, cost := range dailyCost.Costs {
+			total += cost.Amount
+		}
+		xys = append(xys, plotter.XY{X: float64(dailyCost.Date.Day()), Y: total})
+	}
+	return xys
+}
+
+// drawCumulativeChart draws the month-to-date costs of the current month,
+// the previous month and the same month last year.
+func drawCumulativeChart(opts chartOptions, dailyCosts []DailyCosts) (*bytes.Buffer, error) {
+	p := newChartPlot(opts)
+	p.X.Label.Text = "Day of month"
+	p.X.Min = 1
+	p.X.Max = 31
+	p.Y.Min = 0
+
+	l := newLegend(p)
+	months := []time.Time{opts.Month, opts.Month.AddDate(0, -1, 0), opts.Month.AddDate(-1, 0, 0)}
+	for i, month := range months {
+		xys := cumulativeCosts(dailyCosts, month)
+		if len(xys) == 0 {
+			continue
+		}
+		line, err := plotter.NewLine(xys)
+		if err != nil {
+			return nil, err
+		}
+		line.Color = opts.Colors[i%len(opts.Colors)]
+		line.Width = vg.Points(2)
+		if i > 0 {
+			line.Dashes = []vg.Length{vg.Points(6), vg.Points(3)}
+		}
+		p.Add(line)
+		l.Add(month.Format("2006-01"), line)
+	}
+	return writeChart(p, l, opts.Image)
+}
+
+// GranularityWeekly is the granularity of the graph summing daily costs by
+// week from Monday, which Cost Explorer does not support.
+const GranularityWeekly types.Granularity = "WEEKLY"
+
+var granularityTitles = map[types.Granularity]string{
+	types.GranularityDaily:   "Daily",
+	GranularityWeekly:        "Weekly",
+	types.GranularityMonthly: "Monthly",
+}
+
+func validateGranularity(granularity types.Granularity, charts []string) error {
+	if _, ok := granularityTitles[granularity]; !ok {
+		return fmt.Errorf("unsupported granularity %q of the graph", granularity)
+	}
+	if granularity != types.GranularityMonthly {
+		return nil
+	}
+	for _, name := range charts {
+		if name == ChartCumulative || name == ChartHeatmap {
+			return fmt.Errorf("%s chart needs daily costs, but the granularity is %s", name, granularity)
+		}
+	}
+	return nil
+}
+
+// periodEnd returns the end of the period starting at start, exclusive.
+func periodEnd(start time.Time, granularity types.Granularity) time.Time {
+	switch granularity {
+	case GranularityWeekly:
+		return start.AddDate(0, 0, 7)
+	case types.GranularityMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// startOfWeek returns the Monday of the week of t.
+func startOfWeek(t time.Time) time.Time {
+	weekday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-weekday, 0, 0, 0, 0, t.Location())
+}
+
+// aggregateCosts sums daily costs by week when the granularity is weekly.
+// Costs of other granularities are returned as is. The first and the last
+// weeks may be partial.
+func aggregateCosts(dailyCosts []DailyCosts, granularity types.Granularity) []DailyCosts {
+	if granularity != GranularityWeekly {
+		return dailyCosts
+	}
+	type key struct{ accountId, accountName, serviceName, region string }
+	weeks := []DailyCosts{}
+	index := map[key]int{}
+	for _, dailyCost := range dailyCosts {
+		week := startOfWeek(*dailyCost.Date)
+		if len(weeks) == 0 || !weeks[len(weeks)-1].Date.Equal(week) {
+			weeks = append(weeks, DailyCosts{Date: &week, Costs: []Cost{}})
+			index = map[key]int{}
+		}
+		current := &weeks[len(weeks)-1]
+		current.Estimated = current.Estimated || dailyCost.Estimated
+		for _, cost := range dailyCost.Costs {
+			k := key{cost.AccountId, cost.AccountName, cost.ServiceName, cost.Region}
+			if i, ok := index[k]; ok {
+				current.Costs[i].Amount += cost.Amount
+				current.Costs[i].Estimated = current.Costs[i].Estimated || cost.Estimated
+				continue
+			}
+			index[k] = len(current.Costs)
+			current.Costs = append(current.Costs, cost)
+		}
+	}
+	return weeks
+}
+
+// periodLabels returns the X labels of the bars: the first bar of each month
+// and the last bar for daily and weekly costs, and every bar for monthly costs.
+func periodLabels(dailyCosts []DailyCosts, granularity types.Granularity) []string {
+	labels := []string{}
+	for i, dailyCost := range dailyCosts {
+		switch {
+		case granularity == types.GranularityMonthly:
+			labels = append(labels, dailyCost.Date.Format("2006-01"))
+		case i == len(dailyCosts)-1,
+			granularity == GranularityWeekly && dailyCost.Date.Day() <= 7,
+			granularity != GranularityWeekly && dailyCost.Date.Day() == 1:
+			labels = append(labels, dailyCost.Date.Format("2006-01-02"))
+		default:
+			labels = append(labels, "")
+		}
+	}
+	return labels
+}
+
+// barWidth returns the width of bars filling about half of the width of the
+// plot area.
+func barWidth(image ChartImage, bars int) vg.Length {
+	if bars == 0 {
+		return vg.Points(5)
+	}
+	w := image.withDefaults().Width * 0.8 / float64(bars) * 0.5
+	return vg.Points(math.Max(1, math.Min(w, 40)))
+}
+
+// EstimatedColor fades the bars of the days whose costs are not finalized.
+var EstimatedColor = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x99}
+
+// estimatedBars returns bars over the total of each estimated day, padded with
+// zero to n bars, or nil when no day is estimated.
+func estimatedBars(dailyCosts []DailyCosts, n int, width vg.Length) (*plotter.BarChart, error) {
+	values := make(plotter.Values, n)
+	estimated := false
+	for i, dailyCost := range dailyCosts {
+		if !dailyCost.Estimated {
+			continue
+		}
+		estimated = true
+		for _, cost := range dailyCost.Costs {
+			values[i] += cost.Amount
+		}
+	}
+	if !estimated {
+		return nil, nil
+	}
+	bars, err := plotter.NewBarChart(values, width)
+	if err != nil {
+		return nil, err
+	}
+	bars.Color = EstimatedColor
+	// The outline keeps the legend visible on the white background.
+	bars.LineStyle.Color = OthersColor
+	bars.LineStyle.Width = vg.Points(0.5)
+	bars.LineStyle.Dashes = []vg.Length{vg.Points(2), vg.Points(2)}
+	return bars, nil
+}
+
+// AnnotationColor is the color of the annotation markers.
+var AnnotationColor = color.RGBA{R: 0xd6, G: 0x27, B: 0x28, A: 0xff}
+
+// annotationMarkers returns a dashed vertical line of the height and a label
+// at each position of the annotated dates. Labels of the same date are
+// joined. Annotations outside of the chart are ignored.
+func annotationMarkers(annotations []Annotation, positions map[string]int, height float64) ([]plot.Plotter, error) {
+	dates := []string{}
+	labels := map[string][]string{}
+	for _, a := range annotations {
+		if _, ok := positions[a.Date]; !ok {
+			continue
+		}
+		if _, ok := labels[a.Date]; !ok {
+			dates = append(dates, a.Date)
+		}
+		labels[a.Date] = append(labels[a.Date], a.Label)
+	}
+	sort.Strings(dates)
+
+	markers := []plot.Plotter{}
+	for _, date := range dates {
+		x := float64(positions[date])
+		line, err := plotter.NewLine(plotter.XYs{{X: x, Y: 0}, {X: x, Y: height}})
+		if err != nil {
+			return nil, err
+		}
+		line.Color = AnnotationColor
+		line.Dashes = []vg.Length{vg.Points(3), vg.Points(2)}
+		label, err := plotter.NewLabels(plotter.XYLabels{
+			XYs:    plotter.XYs{{X: x, Y: height}},
+			Labels: []string{strings.Join(labels[date], ", ")},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range label.TextStyle {
+			label.TextStyle[i].Color = AnnotationColor
+			label.TextStyle[i].Font.Size = vg.Points(8)
+		}
+		label.Offset = vg.Point{X: vg.Points(2)}
+		markers = append(markers, line, label)
+	}
+	return markers, nil
+}
+
+// calendar is a grid of daily costs with a column per week and a row per
+// weekday, from Monday at the top to Sunday at the bottom. Days without
+// costs are NaN.
+type calendar struct {
+	// Weeks are the Mondays of the columns.
+	Weeks  []time.Time
+	Values [][7]float64
+}
+
+func (c calendar) Dims() (int, int)       { return len(c.Weeks), 7 }
+func (c calendar) Z(col, row int) float64 { return c.Values[col][6-row] }
+func (c calendar) X(col int) float64      { return float64(col) }
+func (c calendar) Y(row int) float64      { return float64(row) }
+
+// Min returns the smallest amount, or zero when no day is negative, so that
+// days with more credits than usage are drawn rather than left blank like
+// days without costs.
+func (c calendar) Min() float64 {
+	min := 0.0
+	for _, week := range c.Values {
+		for _, v := range week {
+			if !math.IsNaN(v) && v < min {
+				min = v
+			}
+		}
+	}
+	return min
+}
+
+// Max returns the largest amount, or zero when no day is positive.
+func (c calendar) Max() float64 {
+	max := 0.0
+	for _, week := range c.Values {
+		for _, v := range week {
+			if !math.IsNaN(v) && v > max {
+				max = v
+			}
+		}
+	}
+	return max
+}
+
+// newCalendar lays out the costs of the account (or the total when account
+// is empty) by week and weekday.
+func newCalendar(dailyCosts []DailyCosts, account string) calendar {
+	c := calendar{}
+	if len(dailyCosts) == 0 {
+		return c
+	}
+	first := *dailyCosts[0].Date
+	weekday := (int(first.Weekday()) + 6) % 7
+	monday := time.Date(first.Year(), first.Month(), first.Day()-weekday, 0, 0, 0, 0, first.Location())
+
+	for _, dailyCost := range dailyCosts {
+		days := int(dailyCost.Date.Sub(monday).Hours()+12) / 24
+		for len(c.Weeks) <= days/7 {
+			c.Weeks = append(c.Weeks, monday.AddDate(0, 0, len(c.Weeks)*7))
+			c.Values = append(c.Values, [7]float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN()})
+		}
+		total := 0.0
+		for _, cost := range dailyCost.Costs {
+			if account == "" || cost.AccountName == account || cost.AccountId == account {
+				total += cost.Amount
+			}
+		}
+		c.Values[days/7][days%7] = total
+	}
+	return c
+}
+
+// drawHeatmap draws the daily costs as a calendar of weeks and weekdays, with
+// a color bar of the amounts on the right side.
+func drawHeatmap(opts chartOptions, dailyCosts []DailyCosts) (*bytes.Buffer, error) {
+	c := newCalendar(dailyCosts, opts.Account)
+	if len(c.Weeks) == 0 {
+		return nil, fmt.Errorf("no costs to draw")
+	}
+
+	colorMap := moreland.SmoothBlueRed()
+	// The range is set from the top, since it must not be empty in between.
+	colorMap.SetMax(math.Max(c.Max(), 1))
+	colorMap.SetMin(c.Min())
+
+	p := plot.New()
+	p.Title.Text = opts.Title
+	heatmap := plotter.NewHeatMap(c, colorMap.Palette(64))
+	heatmap.Min = colorMap.Min()
+	heatmap.Max = colorMap.Max()
+	heatmap.NaN = color.Transparent
+	p.Add(heatmap)
+
+	weekdays := []string{"Sun", "Sat", "Fri", "Thu", "Wed", "Tue", "Mon"}
+	yTicks := []plot.Tick{}
+	for i, name := range weekdays {
+		yTicks = append(yTicks, plot.Tick{Value: float64(i), Label: name})
+	}
+	p.Y.Tick.Marker = plot.ConstantTicks(yTicks)
+	xTicks := []plot.Tick{}
+	for i, week := range c.Weeks {
+		label := ""
+		if i%4 == 0 {
+			label = week.Format("2006-01-02")
+		}
+		xTicks = append(xTicks, plot.Tick{Value: float64(i), Label: label})
+	}
+	p.X.Tick.Marker = plot.ConstantTicks(xTicks)
+
+	bar := plot.New()
+	bar.HideX()
+	bar.Y.Label.Text = fmt.Sprintf("Costs (%s)", opts.Currency.Code)
+	bar.Y.Tick.Marker = currencyTicks{opts.Currency}
+	bar.Add(&plotter.ColorBar{ColorMap: colorMap, Vertical: true})
+
+	img, err := opts.Image.newCanvas()
+	if err != nil {
+		return nil, err
+	}
+	dc := draw.New(img)
+	barWidth := vg.Points(100)
+	p.Draw(draw.Crop(dc, 0, -barWidth, 0, 0))
+	barCanvas := draw.Crop(dc, dc.Max.X-dc.Min.X-barWidth+vg.Points(20), 0, 0, -p.Title.TextStyle.FontExtents().Height)
+	bar.Draw(barCanvas)
+
+	buffer := bytes.NewBuffer([]byte{})
+	if _, err := img.WriteTo(buffer); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+func writeCharts(dir string, charts []Chart) error {
+	for _, chart := range charts {
+		if err := os.WriteFile(filepath.Join(dir, chart.Filename), chart.Buffer.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+const (
+	SavingsPlansLabel      = "Savings Plans"
+	ReservedInstancesLabel = "Reserved Instances"
+)
+
+// Commitment is the health of the Savings Plans or the Reserved Instances on
+// the report day.
+type Commitment struct {
+	Name string `json:"name"`
+	// Utilization and Coverage are in percent.
+	Utilization float64 `json:"utilization"`
+	Coverage    float64 `json:"coverage"`
+	// OnDemandCost is the on-demand spend that is not covered by the
+	// commitment and could be.
+	OnDemandCost float64 `json:"on_demand_cost"`
+	// UnusedCost is the cost of the commitment that was not used.
+	UnusedCost float64 `json:"unused_cost"`
+}
+
+type CostCommitments struct {
+	cfg       *Config
+	awsConfig *aws.Config
+	now       time.Time
+}
+
+func NewCostCommitments(cfg *Config, awsConfig *aws.Config, now time.Time) *CostCommitments {
+	return &CostCommitments{cfg: cfg, awsConfig: awsConfig, now: now}
+}
+
+// Period returns the report day.
+func (c *CostCommitments) Period() *types.DateInterval {
+	return &types.DateInterval{
+		Start: aws.String(c.now.AddDate(0, 0, -2).Format("2006-01-02")),
+		End:   aws.String(c.now.AddDate(0, 0, -1).Format("2006-01-02")),
+	}
+}
+
+// GetCommitments returns the utilization and coverage of the Savings Plans
+// and the Reserved Instances. A commitment without data, e.g. when there are
+// no Reserved Instances, is left out.
+func (c *CostCommitments) GetCommitments() ([]Commitment, error) {
+	commitments := []Commitment{}
+	for _, get := range []func() (Commitment, error){c.getSavingsPlans, c.getReservations} {
+		commitment, err := get()
+		var unavailable *types.DataUnavailableException
+		if errors.As(err, &unavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		commitments = append(commitments, commitment)
+	}
+	return commitments, nil
+}
+
+func (c *CostCommitments) getSavingsPlans() (Commitment, error) {
+	svc := costexplorer.NewFromConfig(*c.awsConfig)
+	utilization, err := svc.GetSavingsPlansUtilization(context.TODO(), &costexplorer.GetSavingsPlansUtilizationInput{
+		TimePeriod: c.Period(),
+	})
+	if err != nil {
+		return Commitment{}, err
+	}
+
+	input := &costexplorer.GetSavingsPlansCoverageInput{
+		TimePeriod: c.Period(),
+	}
+	coverages := []types.SavingsPlansCoverage{}
+	for {
+		coverage, err := svc.GetSavingsPlansCoverage(context.TODO(), input)
+		if err != nil {
+			return Commitment{}, err
+		}
+		coverages = append(coverages, coverage.SavingsPlansCoverages...)
+		if coverage.NextToken == nil {
+			break
+		}
+		input.NextToken = coverage.NextToken
+	}
+	return savingsPlansCommitment(utilization.Total, coverages)
+}
+
+func (c *CostCommitments) getReservations() (Commitment, error) {
+	svc := costexplorer.NewFromConfig(*c.awsConfig)
+	utilization, err := svc.GetReservationUtilization(context.TODO(), &costexplorer.GetReservationUtilizationInput{
+		TimePeriod: c.Period(),
+	})
+	if err != nil {
+		return Commitment{}, err
+	}
+	coverage, err := svc.GetReservationCoverage(context.TODO(), &costexplorer.GetReservationCoverageInput{
+		TimePeriod: c.Period(),
+	})
+	if err != nil {
+		return Commitment{}, err
+	}
+	return reservationCommitment(utilization.Total, coverage.Total)
+}
+
+// savingsPlansCommitment sums the coverages, since the coverage API returns
+// one per day rather than a total.
+func savingsPlansCommitment(utilization *types.SavingsPlansUtilizationAggregates, coverages []types.SavingsPlansCoverage) (Commitment, error) {
+	commitment := Commitment{Name: SavingsPlansLabel}
+	if utilization != nil && utilization.Utilization != nil {
+		var err error
+		if commitment.Utilization, err = parseAmount(utilization.Utilization.UtilizationPercentage); err != nil {
+			return Commitment{}, err
+		}
+		if commitment.UnusedCost, err = parseAmount(utilization.Utilization.UnusedCommitment); err != nil {
+			return Commitment{}, err
+		}
+	}
+
+	var covered, total float64
+	for _, coverage := range coverages {
+		if coverage.Coverage == nil {
+			continue
+		}
+		for _, v := range []struct {
+			value *string
+			dest  *float64
+		}{
+			{coverage.Coverage.OnDemandCost, &commitment.OnDemandCost},
+			{coverage.Coverage.SpendCoveredBySavingsPlans, &covered},
+			{coverage.Coverage.TotalCost, &total},
+		} {
+			amount, err := parseAmount(v.value)
+			if err != nil {
+				return Commitment{}, err
+			}
+			*v.dest += amount
+		}
+	}
+	if total > 0 {
+		commitment.Coverage = covered / total * 100
+	}
+	return commitment, nil
+}
+
+// reservationCommitment takes the coverage in hours, which is the only
+// coverage the API returns for all services.
+func reservationCommitment(utilization *types.ReservationAggregates, coverage *types.Coverage) (Commitment, error) {
+	commitment := Commitment{Name: ReservedInstancesLabel}
+	var err error
+	if utilization != nil {
+		if commitment.Utilization, err = parseAmount(utilization.UtilizationPercentage); err != nil {
+			return Commitment{}, err
+		}
+		if commitment.UnusedCost, err = parseAmount(utilization.RICostForUnusedHours); err != nil {
+			return Commitment{}, err
+		}
+	}
+	if coverage != nil && coverage.CoverageHours != nil {
+		if commitment.Coverage, err = parseAmount(coverage.CoverageHours.CoverageHoursPercentage); err != nil {
+			return Commitment{}, err
+		}
+	}
+	if coverage != nil && coverage.CoverageCost != nil {
+		if commitment.OnDemandCost, err = parseAmount(coverage.CoverageCost.OnDemandCost); err != nil {
+			return Commitment{}, err
+		}
+	}
+	return commitment, nil
+}
+
+// parseAmount parses an amount of the API. A missing amount is zero.
+func parseAmount(s *string) (float64, error) {
+	if s == nil || *s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(*s, 64)
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
@@ -16,7 +19,102 @@ type Config struct {
 	SlackBotToken        string `json:"SLACK_BOT_TOKEN"`
 	SlackChannelId       string `json:"SLACK_CHANNEL"`
 	GetCostAndUsageInput *costexplorer.GetCostAndUsageInput
-	Colors               []string
+	// Metric is the cost metric used by the text report, forecasts and graph,
+	// e.g. "AmortizedCost". Defaults to the first of GetCostAndUsageInput.Metrics
+	// or UnblendedCost.
+	Metric string
+	// Filter is applied to all queries of the report: the daily costs,
+	// the forecasts and the graph. Defaults to GetCostAndUsageInput.Filter,
+	// or an expression excluding Tax.
+	Filter *types.Expression
+	// GroupBy is the grouping of the account table, forecasts and the graph,
+	// e.g. {"Type": "TAG", "Key": "team"} or {"Type": "COST_CATEGORY", "Key": "Product"}.
+	// Defaults to LINKED_ACCOUNT.
+	GroupBy *types.GroupDefinition
+	// Charts are the charts uploaded along with the report: "account",
+	// "service", "cumulative", "account_line", "heatmap" and "region".
+	// Defaults to ["account"].
+	Charts []string
+	// TopServices is the number of services stacked in the service chart.
+	// The others are shown as "Others". Defaults to 10.
+	TopServices int
+	// TopSeries is the number of accounts (or groups) stacked in the account
+	// chart. The others are shown as "Others". Defaults to the number of colors.
+	TopSeries int
+	// BreakdownAccounts is the number of accounts (or groups) in the
+	// per-account service breakdown. Defaults to 3. A negative value hides
+	// the breakdown.
+	BreakdownAccounts int
+	// BreakdownServices is the number of services shown for each account in
+	// the breakdown. Defaults to 5.
+	BreakdownServices int
+	// Gross excludes credits and refunds from the costs, forecasts and charts
+	// of the report, so that they show the usage before credits.
+	Gross bool
+	// RecordTypeBreakdown adds the costs of the report day by record type
+	// (Usage, Credit, Refund, Tax, ...) with the gross usage, the credits and
+	// the net cost.
+	RecordTypeBreakdown bool
+	// RegionReport adds the costs by region below the account table, to
+	// catch resources in regions that should be unused.
+	RegionReport bool
+	// Commitments adds the utilization and coverage of the Savings Plans and
+	// the Reserved Instances.
+	Commitments bool
+	// Recommendations adds the top rightsizing and Savings Plans purchase
+	// recommendations once a week.
+	Recommendations bool
+	// RecommendationWeekday is the day of the week the recommendations are
+	// added on, e.g. "Friday". Defaults to Monday.
+	RecommendationWeekday string
+	// TopRecommendations is the number of recommendations shown of each
+	// kind. Defaults to 5.
+	TopRecommendations int
+	// SavingsPlansPurchaseRecommendationInput overrides the Savings Plans
+	// type, term, payment option and lookback period of the purchase
+	// recommendations. Defaults to 1 year no upfront Compute Savings Plans
+	// per linked account based on 30 days.
+	SavingsPlansPurchaseRecommendationInput *costexplorer.GetSavingsPlansPurchaseRecommendationInput
+	// DrillDown adds the top usage types and operations of the services whose
+	// costs changed the most from the day before.
+	DrillDown bool
+	// DrillDownServices is the number of services drilled down. Defaults to 3.
+	DrillDownServices int
+	// DrillDownItems is the number of usage types and operations shown for
+	// each service. Defaults to 5.
+	DrillDownItems int
+	// HeatmapAccount is the account id or name (or group) the heatmap chart
+	// is drawn for. Defaults to the total of all accounts.
+	HeatmapAccount string
+	Colors         []string
+	// AccountColors are hex colors of specific series in all charts, keyed by
+	// account id, account name, tag value or service name.
+	AccountColors map[string]string
+	// ChartImages configure the format ("png", "svg" or "pdf") and size of
+	// charts per delivery target: "slack" or "file" (dry run).
+	ChartImages map[string]ChartImage
+	// Annotations are events, such as deploys, marked on the daily cost
+	// charts, e.g. [{"date": "2022-11-01", "label": "v1.2.0"}].
+	Annotations []Annotation
+	// AnnotationsFile is a JSON file of annotations in the same form as
+	// Annotations, or a CSV file of date and label columns.
+	AnnotationsFile string
+	// AnnotateAnomalies marks the anomalies detected by Cost Anomaly
+	// Detection on the daily cost charts.
+	AnnotateAnomalies bool
+	// Template is an inline Go template used instead of the default report layout.
+	Template string
+	// TemplateFile is a path to a Go template file used instead of the default report layout.
+	TemplateFile string
+	// Locale selects the message catalog of the report ("ja" or "en"). Defaults to "ja".
+	Locale string
+	// LocaleDir is a directory containing additional catalogs named <locale>.json.
+	LocaleDir string
+	// Currency configures the currency amounts are displayed in. Defaults to USD.
+	Currency *CurrencyConfig
+	// History stores the daily costs and a snapshot of each report in a
+	// directory or an S3 bucket.
+	History *HistoryConfig
 }
 
 type GetCostAndUsageInput struct {
@@ -89,5 +187,165 @@ func NewConfigFromFile(awsConfig aws.Config, path string) (*Config, error) {
 		cfg.SlackChannelId = os.Getenv("SLACK_CHANNEL")
 	}
 
+	if _, ok := forecastMetrics[cfg.CostMetric()]; !ok {
+		return nil, fmt.Errorf("unsupported metric %q", cfg.CostMetric())
+	}
+	if err := validateCharts(cfg.Charts); err != nil {
+		return nil, err
+	}
+	if err := validateGranularity(cfg.GraphGranularity(), cfg.ChartNames()); err != nil {
+		return nil, err
+	}
+	if err := validateChartImages(cfg.ChartImages); err != nil {
+		return nil, err
+	}
+	if err := validateAnnotations(cfg.Annotations); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.recommendationWeekday(); err != nil {
+		return nil, err
+	}
+	if err := validateHistory(cfg.History); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+// ReportFilter returns the filter shared by all queries of the report, so that
+// the text totals and the graph reconcile.
+func (c *Config) ReportFilter() *types.Expression {
+	filter := c.RecordTypeFilter()
+	if filter == nil {
+		filter = &types.Expression{
+			Not: &types.Expression{
+				Dimensions: &types.DimensionValues{
+					Key:    types.DimensionService,
+					Values: []string{"Tax"},
+				},
+			},
+		}
+	}
+	if c.Gross {
+		return andFilters(filter, &types.Expression{
+			Not: &types.Expression{
+				Dimensions: &types.DimensionValues{
+					Key:    types.DimensionRecordType,
+					Values: CreditRecordTypes,
+				},
+			},
+		})
+	}
+	return filter
+}
+
+// RecordTypeFilter returns the configured filter of the report, which is the
+// filter of the record type breakdown. It is nil by default, so that the
+// breakdown lists Tax, which the report excludes.
+func (c *Config) RecordTypeFilter() *types.Expression {
+	if c.Filter != nil {
+		return c.Filter
+	}
+	if c.GetCostAndUsageInput != nil && c.GetCostAndUsageInput.Filter != nil {
+		return c.GetCostAndUsageInput.Filter
+	}
+	return nil
+}
+
+// ReportGroupBy returns the grouping of the account table, forecasts and graph.
+func (c *Config) ReportGroupBy() types.GroupDefinition {
+	if c.GroupBy != nil {
+		return *c.GroupBy
+	}
+	return types.GroupDefinition{
+		Type: types.GroupDefinitionTypeDimension,
+		Key:  aws.String(LinkedAccount),
+	}
+}
+
+// ChartNames returns the charts to render.
+func (c *Config) ChartNames() []string {
+	if c.Charts == nil {
+		return []string{ChartAccount}
+	}
+	return c.Charts
+}
+
+func (c *Config) HasChart(name string) bool {
+	for _, n := range c.ChartNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceBreakdownSize returns the number of accounts and the number of
+// services per account of the service breakdown.
+func (c *Config) ServiceBreakdownSize() (int, int) {
+	accounts, services := c.BreakdownAccounts, c.BreakdownServices
+	if accounts == 0 {
+		accounts = DefaultBreakdownAccounts
+	}
+	if services <= 0 {
+		services = DefaultBreakdownServices
+	}
+	return accounts, services
+}
+
+// IsRecommendationDay reports whether the recommendations are added to the
+// report of now.
+func (c *Config) IsRecommendationDay(now time.Time) bool {
+	weekday, err := c.recommendationWeekday()
+	return c.Recommendations && err == nil && now.Weekday() == weekday
+}
+
+func (c *Config) recommendationWeekday() (time.Weekday, error) {
+	if c.RecommendationWeekday == "" {
+		return time.Monday, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), c.RecommendationWeekday) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q of RecommendationWeekday", c.RecommendationWeekday)
+}
+
+// DrillDownSize returns the number of services drilled down and the number of
+// usage types and operations per service.
+func (c *Config) DrillDownSize() (int, int) {
+	services, items := c.DrillDownServices, c.DrillDownItems
+	if services <= 0 {
+		services = DefaultDrillDownServices
+	}
+	if items <= 0 {
+		items = DefaultDrillDownItems
+	}
+	return services, items
+}
+
+// GraphGranularity returns the granularity of the graph set by
+// GetCostAndUsageInput.Granularity: DAILY (default), WEEKLY or MONTHLY.
+func (c *Config) GraphGranularity() types.Granularity {
+	if c.GetCostAndUsageInput != nil && c.GetCostAndUsageInput.Granularity != "" {
+		return c.GetCostAndUsageInput.Granularity
+	}
+	return types.GranularityDaily
+}
+
+// ChartImage returns the image format and size of charts delivered to the target.
+func (c *Config) ChartImage(target string) ChartImage {
+	return c.ChartImages[target].withDefaults()
+}
+
+// CostMetric returns the cost metric used throughout the report.
+func (c *Config) CostMetric() string {
+	if c.Metric != "" {
+		return c.Metric
+	}
+	if c.GetCostAndUsageInput != nil && len(c.GetCostAndUsageInput.Metrics) > 0 {
+		return c.GetCostAndUsageInput.Metrics[0]
+	}
+	return UnblendedCost
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/plot"
+)
+
+const DefaultCurrency = "USD"
+
+// zeroDecimalCurrencies are currencies without minor units.
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+	"VND": true,
+}
+
+// CurrencyConfig configures the currency amounts are displayed in.
+// Cost Explorer always returns USD, so any other currency needs an exchange
+// rate, given either by Rate or by RatesFile.
+type CurrencyConfig struct {
+	// Code is the ISO 4217 code of the display currency. Defaults to USD.
+	Code string
+	// Symbol is shown instead of the code, e.g. "¥".
+	Symbol string
+	// Decimals overrides the number of decimal places.
+	Decimals *int
+	// Rate is the amount of the display currency per 1 USD.
+	Rate float64
+	// RatesFile is a JSON file of rates per currency code, e.g. {"JPY": 150.2}.
+	RatesFile string
+}
+
+// Currency converts USD amounts to the display currency and formats them
+// with the separators of the locale.
+type Currency struct {
+	Code     string
+	Symbol   string
+	Decimals int
+	Rate     float64
+
+	format             string
+	thousandsSeparator string
+	decimalSeparator   string
+}
+
+func NewCurrency(cfg *Config, messages *Messages) (*Currency, error) {
+	currencyConfig := cfg.Currency
+	if currencyConfig == nil {
+		currencyConfig = &CurrencyConfig{}
+	}
+
+	c := &Currency{
+		Code:               strings.ToUpper(currencyConfig.Code),
+		Symbol:             currencyConfig.Symbol,
+		Decimals:           2,
+		Rate:               currencyConfig.Rate,
+		format:             messages.CurrencyFormat,
+		thousandsSeparator: messages.ThousandsSeparator,
+		decimalSeparator:   messages.DecimalSeparator,
+	}
+	if c.Code == "" {
+		c.Code = DefaultCurrency
+	}
+	if c.Symbol == "" {
+		c.Symbol = messages.CurrencySymbols[c.Code]
+	}
+	if zeroDecimalCurrencies[c.Code] {
+		c.Decimals = 0
+	}
+	if currencyConfig.Decimals != nil {
+		c.Decimals = *currencyConfig.Decimals
+	}
+
+	if c.Code == DefaultCurrency {
+		c.Rate = 1
+	}
+	if c.Rate == 0 && currencyConfig.RatesFile != "" {
+		rate, err := loadRate(currencyConfig.RatesFile, c.Code)
+		if err != nil {
+			return nil, err
+		}
+		c.Rate = rate
+	}
+	if c.Rate <= 0 {
+		return nil, fmt.Errorf("no exchange rate for %s: set Currency.Rate or Currency.RatesFile", c.Code)
+	}
+	return c, nil
+}
+
+func defaultCurrency() *Currency {
+	c, err := NewCurrency(&Config{}, defaultMessages())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func loadRate(path string, code string) (float64, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rates file: %w", err)
+	}
+	rates := map[string]float64{}
+	if err := json.Unmarshal(buf, &rates); err != nil {
+		return 0, fmt.Errorf("failed to parse rates file %s: %w", path, err)
+	}
+	rate, ok := rates[code]
+	if !ok {
+		return 0, fmt.Errorf("rates file %s has no rate for %s", path, code)
+	}
+	return rate, nil
+}
+
+// Convert converts an amount in USD to the display currency.
+func (c *Currency) Convert(usd float64) float64 {
+	return usd * c.Rate
+}
+
+// FormatNumber formats an amount with the decimal places of the currency and
+// the separators of the locale, e.g. "1,234.50".
+func (c *Currency) FormatNumber(amount float64) string {
+	s := strconv.FormatFloat(math.Abs(amount), 'f', c.Decimals, 64)
+	integer, fraction, _ := strings.Cut(s, ".")
+
+	b := new(strings.Builder)
+	if amount < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteString("-")
+	}
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(c.thousandsSeparator)
+		}
+		b.WriteRune(r)
+	}
+	if fraction != "" {
+		b.WriteString(c.decimalSeparator)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// Format formats an amount with the symbol or code of the currency, e.g. "1,234.50 USD".
+// The sign of a negative amount goes before the symbol, e.g. "-$0.50".
+func (c *Currency) Format(amount float64) string {
+	symbol := c.Symbol
+	if symbol == "" {
+		symbol = c.Code
+	}
+	number := c.FormatNumber(amount)
+	if n, ok := strings.CutPrefix(number, "-"); ok {
+		return "-" + fmt.Sprintf(c.format, n, symbol)
+	}
+	return fmt.Sprintf(c.format, number, symbol)
+}
+
+// FormatPlain formats an amount for machine-readable outputs, without
+// thousands separators.
+func (c *Currency) FormatPlain(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', c.Decimals, 64)
+}
+
+// currencyTicks formats the tick labels of a chart axis as amounts of the currency.
+type currencyTicks struct {
+	currency *Currency
+}
+
+func (t currencyTicks) Ticks(min, max float64) []plot.Tick {
+	ticks := plot.DefaultTicks{}.Ticks(min, max)
+	for i := range ticks {
+		if ticks[i].Label == "" {
+			continue
+		}
+		c := *t.currency
+		c.Decimals = 0
+		if max-min < 10 {
+			c.Decimals = t.currency.Decimals
+		}
+		ticks[i].Label = c.FormatNumber(ticks[i].Value)
+	}
+	return ticks
+}
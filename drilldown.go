@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+const (
+	DefaultDrillDownServices = 3
+	DefaultDrillDownItems    = 5
+)
+
+// DrillDown is the usage types and operations behind the change of the cost
+// of a service from the day before the report day.
+type DrillDown struct {
+	ServiceName string      `json:"service"`
+	Amount      float64     `json:"amount"`
+	Previous    float64     `json:"previous"`
+	Items       []UsageCost `json:"items"`
+	// Estimated tells that the costs of the report day are not finalized.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// UsageCost is the cost of a usage type and operation of a service.
+type UsageCost struct {
+	UsageType string  `json:"usage_type"`
+	Operation string  `json:"operation"`
+	Amount    float64 `json:"amount"`
+	Previous  float64 `json:"previous"`
+}
+
+func (d DrillDown) Change() float64 {
+	return d.Amount - d.Previous
+}
+
+func (u UsageCost) Change() float64 {
+	return u.Amount - u.Previous
+}
+
+// dayAmounts are the amounts of the day before the report day and the report
+// day, keyed by up to two group keys.
+type dayAmounts map[[2]string][2]float64
+
+type CostDrillDown struct {
+	cfg       *Config
+	awsConfig *aws.Config
+	now       time.Time
+}
+
+func NewCostDrillDown(cfg *Config, awsConfig *aws.Config, now time.Time) *CostDrillDown {
+	return &CostDrillDown{cfg: cfg, awsConfig: awsConfig, now: now}
+}
+
+// Period returns the day before the report day and the report day.
+func (d *CostDrillDown) Period() *types.DateInterval {
+	return &types.DateInterval{
+		Start: aws.String(d.now.AddDate(0, 0, -3).Format("2006-01-02")),
+		End:   aws.String(d.now.AddDate(0, 0, -1).Format("2006-01-02")),
+	}
+}
+
+// GetDrillDowns returns the top usage types and operations of the services
+// whose costs changed the most from the day before.
+func (d *CostDrillDown) GetDrillDowns() ([]DrillDown, error) {
+	services, items := d.cfg.DrillDownSize()
+	serviceAmounts, estimated, err := d.getAmounts(d.cfg.ReportFilter(), "SERVICE")
+	if err != nil {
+		return nil, err
+	}
+
+	drillDowns := []DrillDown{}
+	for _, service := range topChanges(serviceAmounts, services) {
+		amounts := serviceAmounts[service]
+		filter := andFilters(d.cfg.ReportFilter(), &types.Expression{
+			Dimensions: &types.DimensionValues{
+				Key:    types.DimensionService,
+				Values: []string{service[0]},
+			},
+		})
+		usageAmounts, _, err := d.getAmounts(filter, "USAGE_TYPE", "OPERATION")
+		if err != nil {
+			return nil, err
+		}
+		drillDown := DrillDown{ServiceName: service[0], Previous: amounts[0], Amount: amounts[1], Items: []UsageCost{}, Estimated: estimated}
+		for _, usage := range topChanges(usageAmounts, items) {
+			drillDown.Items = append(drillDown.Items, UsageCost{
+				UsageType: usage[0],
+				Operation: usage[1],
+				Previous:  usageAmounts[usage][0],
+				Amount:    usageAmounts[usage][1],
+			})
+		}
+		drillDowns = append(drillDowns, drillDown)
+	}
+	return drillDowns, nil
+}
+
+// getAmounts returns the amounts of the two days, and whether the costs of
+// the report day are not finalized.
+func (d *CostDrillDown) getAmounts(filter *types.Expression, keys ...string) (dayAmounts, bool, error) {
+	svc := costexplorer.NewFromConfig(*d.awsConfig)
+	input := &costexplorer.GetCostAndUsageInput{
+		Metrics:     []string{d.cfg.CostMetric()},
+		TimePeriod:  d.Period(),
+		Granularity: types.GranularityDaily,
+		Filter:      filter,
+	}
+	for _, key := range keys {
+		input.GroupBy = append(input.GroupBy, types.GroupDefinition{
+			Type: types.GroupDefinitionTypeDimension,
+			Key:  aws.String(key),
+		})
+	}
+
+	results := []types.ResultByTime{}
+	for {
+		output, err := svc.GetCostAndUsage(context.TODO(), input)
+		if err != nil {
+			return nil, false, err
+		}
+		results = append(results, output.ResultsByTime...)
+		if output.NextPageToken == nil {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+	amounts, err := toDayAmounts(results, d.cfg.CostMetric(), *d.Period().Start)
+	if err != nil {
+		return nil, false, err
+	}
+	return amounts, reportDayEstimated(results, *d.Period().Start), nil
+}
+
+// reportDayEstimated tells whether the results of the report day, which is
+// the day after previousDay, are not finalized.
+func reportDayEstimated(results []types.ResultByTime, previousDay string) bool {
+	for _, result := range results {
+		if *result.TimePeriod.Start != previousDay && result.Estimated {
+			return true
+		}
+	}
+	return false
+}
+
+// toDayAmounts sums the results of the two days by group keys. Results of
+// the first day are the previous amounts.
+func toDayAmounts(results []types.ResultByTime, metric string, previousDay string) (dayAmounts, error) {
+	amounts := dayAmounts{}
+	for _, result := range results {
+		day := 1
+		if *result.TimePeriod.Start == previousDay {
+			day = 0
+		}
+		for _, group := range result.Groups {
+			amount, err := strconv.ParseFloat(*group.Metrics[metric].Amount, 64)
+			if err != nil {
+				return nil, err
+			}
+			var key [2]string
+			copy(key[:], group.Keys)
+			a := amounts[key]
+			a[day] += amount
+			amounts[key] = a
+		}
+	}
+	return amounts, nil
+}
+
+// topChanges returns the n keys with the largest absolute change.
+func topChanges(amounts dayAmounts, n int) [][2]string {
+	keys := make([][2]string, 0, len(amounts))
+	for key, a := range amounts {
+		if a[0] != a[1] {
+			keys = append(keys, key)
+		}
+	}
+	change := func(key [2]string) float64 {
+		return math.Abs(amounts[key][1] - amounts[key][0])
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if change(keys[i]) != change(keys[j]) {
+			return change(keys[i]) > change(keys[j])
+		}
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
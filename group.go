@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+)
+
+const (
+	LinkedAccount = "LINKED_ACCOUNT"
+
+	// UntaggedLabel is the label of costs without the tag of the report grouping.
+	UntaggedLabel = "untagged"
+	// UncategorizedLabel is the label of costs without a value of the cost
+	// category of the report grouping.
+	UncategorizedLabel = "uncategorized"
+)
+
+// Group is a value of the report grouping, such as an account or a tag value,
+// with the filter selecting its costs.
+type Group struct {
+	Id     string
+	Name   string
+	Filter *types.Expression
+}
+
+func isLinkedAccount(def types.GroupDefinition) bool {
+	return def.Type == types.GroupDefinitionTypeDimension && aws.ToString(def.Key) == LinkedAccount
+}
+
+// groupLabel returns the label of a group key returned by Cost Explorer.
+// Tag and cost category keys are returned as "key$value", and "key$" for
+// costs without a value.
+func groupLabel(def types.GroupDefinition, key string, linkedAccounts map[string]string) string {
+	switch def.Type {
+	case types.GroupDefinitionTypeTag:
+		return valueLabel(key, UntaggedLabel)
+	case types.GroupDefinitionTypeCostCategory:
+		return valueLabel(key, UncategorizedLabel)
+	default:
+		if isLinkedAccount(def) {
+			if name := linkedAccounts[key]; name != "" {
+				return name
+			}
+		}
+		return key
+	}
+}
+
+// valueLabel returns the value of a "key$value" group key, or the fallback
+// label for costs without a value.
+func valueLabel(key string, fallback string) string {
+	_, value, _ := strings.Cut(key, "$")
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// valueGroups returns a group per value and a group labeled fallback for
+// costs without a value. filter returns the expression selecting a value, or
+// the costs without a value when it is empty.
+func valueGroups(values []string, fallback string, filter func(value string) *types.Expression) []Group {
+	groups := []Group{}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		groups = append(groups, Group{Name: value, Filter: filter(value)})
+	}
+	return append(groups, Group{Name: fallback, Filter: filter("")})
+}
+
+// groupHeader returns the table header of the grouping, or an empty string
+// when costs are grouped by account.
+func groupHeader(def types.GroupDefinition) string {
+	if isLinkedAccount(def) {
+		return ""
+	}
+	return aws.ToString(def.Key)
+}
+
+// listGroups returns the values of the grouping seen in the last month,
+// which are used to get forecasts per group.
+func listGroups(cfg *Config, awsConfig *aws.Config, now time.Time) ([]Group, error) {
+	def := cfg.ReportGroupBy()
+	period := &types.DateInterval{
+		Start: aws.String(now.AddDate(0, -1, 0).Format("2006-01-02")),
+		End:   aws.String(now.Format("2006-01-02")),
+	}
+	key := aws.ToString(def.Key)
+
+	switch {
+	case isLinkedAccount(def):
+		organizationSvc := organizations.NewFromConfig(*awsConfig)
+		listAccountOutput, err := organizationSvc.ListAccounts(context.TODO(), &organizations.ListAccountsInput{})
+		if err != nil {
+			return nil, err
+		}
+		groups := []Group{}
+		for _, account := range listAccountOutput.Accounts {
+			groups = append(groups, Group{
+				Id:   *account.Id,
+				Name: *account.Name,
+				Filter: &types.Expression{
+					Dimensions: &types.DimensionValues{
+						Key:    LinkedAccount,
+						Values: []string{*account.Id},
+					},
+				},
+			})
+		}
+		return groups, nil
+	case def.Type == types.GroupDefinitionTypeTag:
+		svc := costexplorer.NewFromConfig(*awsConfig)
+		values := []string{}
+		var token *string
+		for {
+			output, err := svc.GetTags(context.TODO(), &costexplorer.GetTagsInput{
+				TagKey:        def.Key,
+				TimePeriod:    period,
+				NextPageToken: token,
+			})
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, output.Tags...)
+			if output.NextPageToken == nil {
+				break
+			}
+			token = output.NextPageToken
+		}
+		return valueGroups(values, UntaggedLabel, func(value string) *types.Expression {
+			if value == "" {
+				return &types.Expression{Tags: &types.TagValues{Key: def.Key, MatchOptions: []types.MatchOption{types.MatchOptionAbsent}}}
+			}
+			return &types.Expression{Tags: &types.TagValues{Key: def.Key, Values: []string{value}}}
+		}), nil
+	case def.Type == types.GroupDefinitionTypeCostCategory:
+		svc := costexplorer.NewFromConfig(*awsConfig)
+		values := []string{}
+		var token *string
+		for {
+			output, err := svc.GetCostCategories(context.TODO(), &costexplorer.GetCostCategoriesInput{
+				CostCategoryName: def.Key,
+				TimePeriod:       period,
+				NextPageToken:    token,
+			})
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, output.CostCategoryValues...)
+			if output.NextPageToken == nil {
+				break
+			}
+			token = output.NextPageToken
+		}
+		return valueGroups(values, UncategorizedLabel, func(value string) *types.Expression {
+			if value == "" {
+				return &types.Expression{CostCategories: &types.CostCategoryValues{Key: def.Key, MatchOptions: []types.MatchOption{types.MatchOptionAbsent}}}
+			}
+			return &types.Expression{CostCategories: &types.CostCategoryValues{Key: def.Key, Values: []string{value}}}
+		}), nil
+	default:
+		svc := costexplorer.NewFromConfig(*awsConfig)
+		groups := []Group{}
+		var token *string
+		for {
+			output, err := svc.GetDimensionValues(context.TODO(), &costexplorer.GetDimensionValuesInput{
+				Dimension:     types.Dimension(key),
+				TimePeriod:    period,
+				NextPageToken: token,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range output.DimensionValues {
+				groups = append(groups, Group{
+					Id:   aws.ToString(value.Value),
+					Name: aws.ToString(value.Value),
+					Filter: &types.Expression{
+						Dimensions: &types.DimensionValues{
+							Key:    types.Dimension(key),
+							Values: []string{aws.ToString(value.Value)},
+						},
+					},
+				})
+			}
+			if output.NextPageToken == nil {
+				break
+			}
+			token = output.NextPageToken
+		}
+		return groups, nil
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ForecastHistoryDays is how many days before the report day the forecast is
+// compared with.
+const ForecastHistoryDays = 7
+
+var ErrHistoryNotFound = errors.New("not found in history")
+
+// HistoryConfig configures the store of the costs and forecasts of each run.
+// Either Dir or Bucket is set.
+type HistoryConfig struct {
+	// Dir is the directory of the file store.
+	Dir string
+	// Bucket is the S3 bucket of the store.
+	Bucket string
+	// Prefix is the key prefix of the objects in Bucket.
+	Prefix string
+	// Endpoint is the URL of an S3-compatible storage, such as MinIO, which
+	// is accessed with path-style requests.
+	Endpoint string
+}
+
+func validateHistory(cfg *HistoryConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if (cfg.Dir == "") == (cfg.Bucket == "") {
+		return fmt.Errorf("either History.Dir or History.Bucket must be set")
+	}
+	return nil
+}
+
+// HistoryStore stores objects by slash-separated keys. Get returns
+// ErrHistoryNotFound for a missing key.
+type HistoryStore interface {
+	Get(key string) ([]byte, error)
+	Put(key string, body []byte) error
+}
+
+type fileHistoryStore struct {
+	dir string
+}
+
+func (s *fileHistoryStore) Get(key string) ([]byte, error) {
+	buf, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrHistoryNotFound
+	}
+	return buf, err
+}
+
+// Put writes to a temporary file first so that a failed run does not leave a
+// broken object behind.
+func (s *fileHistoryStore) Put(key string, body []byte) error {
+	name := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, body, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+type s3HistoryStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3HistoryStore) Get(key string) ([]byte, error) {
+	output, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, key)),
+	})
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrHistoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+func (s *s3HistoryStore) Put(key string, body []byte) error {
+	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(path.Join(s.prefix, key)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// readOnlyHistoryStore reads from the store but discards writes.
+type readOnlyHistoryStore struct {
+	HistoryStore
+}
+
+func (s readOnlyHistoryStore) Put(key string, body []byte) error {
+	slog.Debug("history is read-only, not saving", "key", key)
+	return nil
+}
+
+// CostHistory keeps the finalized daily costs of the queries, so that they
+// are not fetched again, and a snapshot of the report of each day.
+type CostHistory struct {
+	store HistoryStore
+	// query is the report configuration the snapshots are kept apart by.
+	query reportQuery
+}
+
+// reportQuery is what the numbers of a report depend on besides the day.
+// Reports of different queries may share a store, e.g. a bucket.
+type reportQuery struct {
+	Metric  string                `json:"metric"`
+	Gross   bool                  `json:"gross,omitempty"`
+	GroupBy types.GroupDefinition `json:"group_by"`
+	Filter  *types.Expression     `json:"filter,omitempty"`
+}
+
+func newReportQuery(cfg *Config) reportQuery {
+	return reportQuery{
+		Metric:  cfg.CostMetric(),
+		Gross:   cfg.Gross,
+		GroupBy: cfg.ReportGroupBy(),
+		Filter:  cfg.ReportFilter(),
+	}
+}
+
+// NewCostHistory returns nil when the history is not configured.
+func NewCostHistory(cfg *Config, awsConfig aws.Config) *CostHistory {
+	if cfg.History == nil {
+		return nil
+	}
+	query := newReportQuery(cfg)
+	if cfg.History.Dir != "" {
+		return &CostHistory{store: &fileHistoryStore{dir: cfg.History.Dir}, query: query}
+	}
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if cfg.History.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.History.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &CostHistory{store: &s3HistoryStore{client: client, bucket: cfg.History.Bucket, prefix: cfg.History.Prefix}, query: query}
+}
+
+// ReadOnly returns a history that reads the stored costs and snapshots but
+// does not save any, e.g. for dry runs with a test config.
+func (h *CostHistory) ReadOnly() *CostHistory {
+	if h == nil {
+		return nil
+	}
+	return &CostHistory{store: readOnlyHistoryStore{h.store}, query: h.query}
+}
+
+// fingerprint returns a short hash of the JSON of v.
+func fingerprint(v any) (string, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// historyDay is the finalized costs of a day.
+type historyDay struct {
+	Date  string `json:"date"`
+	Costs []Cost `json:"costs"`
+}
+
+// queryKey identifies the query of daily costs regardless of its period, so
+// that the days of different queries, e.g. by account and by service, are
+// kept apart.
+func queryKey(input *costexplorer.GetCostAndUsageInput) (string, error) {
+	return fingerprint(struct {
+		Metrics     []string
+		Granularity types.Granularity
+		Filter      *types.Expression
+		GroupBy     []types.GroupDefinition
+	}{input.Metrics, input.Granularity, input.Filter, input.GroupBy})
+}
+
+func dailyCostsKey(query string, month string) string {
+	return fmt.Sprintf("daily/%s/%s.json", query, month)
+}
+
+// DailyCosts returns the daily costs of the input. The finalized days stored
+// before are read from the history, and only the days after them are
+// fetched. The newly finalized days are stored. Failures of the history are
+// logged and the whole period is fetched instead.
+func (h *CostHistory) DailyCosts(input *costexplorer.GetCostAndUsageInput, fetch func(*costexplorer.GetCostAndUsageInput) ([]DailyCosts, error)) ([]DailyCosts, error) {
+	start, err := time.Parse("2006-01-02", *input.TimePeriod.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse("2006-01-02", *input.TimePeriod.End)
+	if err != nil {
+		return nil, err
+	}
+	query, err := queryKey(input)
+	if err != nil {
+		return nil, err
+	}
+
+	months := map[string]map[string][]Cost{}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		month := d.Format("2006-01")
+		if months[month] != nil {
+			continue
+		}
+		days, err := h.loadMonth(query, month)
+		if err != nil {
+			slog.Error("failed to read daily costs from history", "month", month, "error", err)
+			return fetch(input)
+		}
+		months[month] = days
+	}
+
+	// Use the stored days up to the first missing one.
+	dailyCosts := []DailyCosts{}
+	from := start
+	for ; from.Before(end); from = from.AddDate(0, 0, 1) {
+		costs, ok := months[from.Format("2006-01")][from.Format("2006-01-02")]
+		if !ok {
+			break
+		}
+		date := from
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: costs})
+	}
+	slog.Debug("daily costs read from history", "days", len(dailyCosts))
+	if !from.Before(end) {
+		return dailyCosts, nil
+	}
+
+	rest := *input
+	rest.TimePeriod = &types.DateInterval{
+		Start: aws.String(from.Format("2006-01-02")),
+		End:   input.TimePeriod.End,
+	}
+	fetched, err := fetch(&rest)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]bool{}
+	for _, dailyCost := range fetched {
+		if dailyCost.Estimated {
+			continue
+		}
+		month := dailyCost.Date.Format("2006-01")
+		if months[month] == nil {
+			months[month] = map[string][]Cost{}
+		}
+		months[month][dailyCost.Date.Format("2006-01-02")] = dailyCost.Costs
+		changed[month] = true
+	}
+	for month := range changed {
+		if err := h.saveMonth(query, month, months[month]); err != nil {
+			slog.Error("failed to save daily costs to history", "month", month, "error", err)
+		}
+	}
+	return append(dailyCosts, fetched...), nil
+}
+
+func (h *CostHistory) loadMonth(query string, month string) (map[string][]Cost, error) {
+	days := map[string][]Cost{}
+	buf, err := h.store.Get(dailyCostsKey(query, month))
+	if errors.Is(err, ErrHistoryNotFound) {
+		return days, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored := []historyDay{}
+	if err := json.Unmarshal(buf, &stored); err != nil {
+		return nil, err
+	}
+	for _, day := range stored {
+		days[day.Date] = day.Costs
+	}
+	return days, nil
+}
+
+func (h *CostHistory) saveMonth(query string, month string, days map[string][]Cost) error {
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	stored := []historyDay{}
+	for _, date := range dates {
+		stored = append(stored, historyDay{Date: date, Costs: days[date]})
+	}
+	buf, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return h.store.Put(dailyCostsKey(query, month), buf)
+}
+
+// Snapshot is what was reported on a day, in USD. A later run for the same
+// day replaces it.
+type Snapshot struct {
+	CreatedAt      time.Time           `json:"created_at"`
+	Period         *jsonPeriod         `json:"period"`
+	Metric         string              `json:"metric"`
+	Gross          bool                `json:"gross,omitempty"`
+	GroupBy        string              `json:"group_by,omitempty"`
+	Query          reportQuery         `json:"query"`
+	Costs          []Cost              `json:"costs"`
+	ForecastPeriod *jsonPeriod         `json:"forecast_period,omitempty"`
+	Forecasts      map[string]float64  `json:"forecasts,omitempty"`
+	DailyForecasts []jsonDailyForecast `json:"daily_forecasts,omitempty"`
+}
+
+func newSnapshot(report *Report, query reportQuery, now time.Time) *Snapshot {
+	snapshot := &Snapshot{
+		CreatedAt:      now,
+		Period:         newJSONPeriod(report.Period),
+		Metric:         report.Metric,
+		Gross:          report.Gross,
+		GroupBy:        report.GroupBy,
+		Query:          query,
+		Costs:          report.Costs,
+		ForecastPeriod: newJSONPeriod(report.ForecastPeriod),
+		Forecasts:      report.Forecasts,
+	}
+	for _, f := range report.DailyForecasts {
+		snapshot.DailyForecasts = append(snapshot.DailyForecasts, jsonDailyForecast{Date: f.Date.Format("2006-01-02"), Mean: f.Mean, Lower: f.Lower, Upper: f.Upper})
+	}
+	return snapshot
+}
+
+// Report returns the report of the snapshot, without the daily costs.
+func (s *Snapshot) Report() (*Report, error) {
+	report := &Report{
+		Period:    s.Period.dateInterval(),
+		Metric:    s.Metric,
+		Gross:     s.Gross,
+		GroupBy:   s.GroupBy,
+		Costs:     s.Costs,
+		Forecasts: s.Forecasts,
+	}
+	if s.ForecastPeriod != nil {
+		report.ForecastPeriod = s.ForecastPeriod.dateInterval()
+	}
+	for _, f := range s.DailyForecasts {
+		date, err := time.Parse("2006-01-02", f.Date)
+		if err != nil {
+			return nil, err
+		}
+		report.DailyForecasts = append(report.DailyForecasts, DailyForecast{Date: &date, Mean: f.Mean, Lower: f.Lower, Upper: f.Upper})
+	}
+	return report, nil
+}
+
+// snapshotKey returns the key of the snapshot of the day, which is kept
+// apart from the snapshots of other queries.
+func (h *CostHistory) snapshotKey(date string) (string, error) {
+	query, err := fingerprint(h.query)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("snapshots/%s/%s.json", query, date), nil
+}
+
+// SaveSnapshot stores the report, which must be in USD, by its report day.
+func (h *CostHistory) SaveSnapshot(report *Report, now time.Time) error {
+	key, err := h.snapshotKey(*report.Period.Start)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(newSnapshot(report, h.query, now), "", "  ")
+	if err != nil {
+		return err
+	}
+	return h.store.Put(key, buf)
+}
+
+// Snapshot returns the snapshot of the report day in the form of "2006-01-02".
+func (h *CostHistory) Snapshot(date string) (*Snapshot, error) {
+	key, err := h.snapshotKey(date)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := h.store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the snapshot of %s: %w", date, err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(buf, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse the snapshot of %s: %w", date, err)
+	}
+	return &snapshot, nil
+}
+
+// PreviousForecast is the forecast of the same month reported some days
+// before.
+type PreviousForecast struct {
+	Date  string  `json:"date"`
+	Total float64 `json:"total"`
+}
+
+// PreviousForecast returns the forecast of the same month reported
+// ForecastHistoryDays before the report, or nil when there is none.
+func (h *CostHistory) PreviousForecast(report *Report) (*PreviousForecast, error) {
+	if report.ForecastPeriod == nil {
+		return nil, nil
+	}
+	reportDate, err := time.Parse("2006-01-02", *report.Period.Start)
+	if err != nil {
+		return nil, err
+	}
+	date := reportDate.AddDate(0, 0, -ForecastHistoryDays).Format("2006-01-02")
+	snapshot, err := h.Snapshot(date)
+	if errors.Is(err, ErrHistoryNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return previousForecast(snapshot, h.query, *report.ForecastPeriod.End)
+}
+
+// previousForecast returns the total forecast of the snapshot if it is of the
+// month ending at forecastEnd and of the same metric, grouping and filter as
+// the query.
+func previousForecast(snapshot *Snapshot, query reportQuery, forecastEnd string) (*PreviousForecast, error) {
+	if snapshot.ForecastPeriod == nil || len(snapshot.Forecasts) == 0 || snapshot.ForecastPeriod.End != forecastEnd {
+		return nil, nil
+	}
+	// The query is compared by its JSON, as the snapshot was read from it.
+	want, err := fingerprint(query)
+	if err != nil {
+		return nil, err
+	}
+	got, err := fingerprint(snapshot.Query)
+	if err != nil {
+		return nil, err
+	}
+	if got != want {
+		return nil, nil
+	}
+	previous := &PreviousForecast{Date: snapshot.Period.Start}
+	for _, f := range snapshot.Forecasts {
+		previous.Total += f
+	}
+	return previous, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const DefaultLocale = "ja"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Messages is a message catalog of a locale.
+type Messages struct {
+	DateFormat string
+	MonthNames []string
+	// CurrencyFormat is a format of amounts, where %[1]s is the number and
+	// %[2]s is the currency symbol or code.
+	CurrencyFormat     string
+	CurrencySymbols    map[string]string
+	ThousandsSeparator string
+	DecimalSeparator   string
+	Texts              map[string]string
+}
+
+// messagesFile is the format of a catalog file. Separators are pointers so
+// that a catalog can set them to an empty string.
+type messagesFile struct {
+	DateFormat         string            `json:"date_format"`
+	MonthNames         []string          `json:"month_names"`
+	CurrencyFormat     string            `json:"currency_format"`
+	CurrencySymbols    map[string]string `json:"currency_symbols"`
+	ThousandsSeparator *string           `json:"thousands_separator"`
+	DecimalSeparator   *string           `json:"decimal_separator"`
+	Texts              map[string]string `json:"messages"`
+}
+
+// NewMessages loads the catalog of the configured locale. Catalogs in
+// LocaleDir take precedence over the built-in ones, so that new locales can
+// be added without rebuilding. Keys missing from a catalog fall back to the
+// built-in English catalog.
+func NewMessages(cfg *Config) (*Messages, error) {
+	locale := cfg.Locale
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
+	messages, err := loadBuiltinMessages("en")
+	if err != nil {
+		return nil, err
+	}
+
+	found := locale == "en"
+	if locale != "en" {
+		if buf, err := localeFS.ReadFile("locales/" + locale + ".json"); err == nil {
+			if err := messages.merge(buf); err != nil {
+				return nil, fmt.Errorf("failed to load locale %s: %w", locale, err)
+			}
+			found = true
+		}
+	}
+	if cfg.LocaleDir != "" {
+		buf, err := os.ReadFile(filepath.Join(cfg.LocaleDir, locale+".json"))
+		if err == nil {
+			if err := messages.merge(buf); err != nil {
+				return nil, fmt.Errorf("failed to load locale %s: %w", locale, err)
+			}
+			found = true
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown locale %q", locale)
+	}
+	if len(messages.MonthNames) != 12 {
+		return nil, fmt.Errorf("locale %s must have 12 month names", locale)
+	}
+	return messages, nil
+}
+
+func defaultMessages() *Messages {
+	messages, err := NewMessages(&Config{})
+	if err != nil {
+		panic(err)
+	}
+	return messages
+}
+
+func loadBuiltinMessages(locale string) (*Messages, error) {
+	buf, err := localeFS.ReadFile("locales/" + locale + ".json")
+	if err != nil {
+		return nil, err
+	}
+	messages := &Messages{CurrencySymbols: map[string]string{}, Texts: map[string]string{}}
+	if err := messages.merge(buf); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (m *Messages) merge(buf []byte) error {
+	var other messagesFile
+	if err := json.Unmarshal(buf, &other); err != nil {
+		return err
+	}
+	if other.DateFormat != "" {
+		m.DateFormat = other.DateFormat
+	}
+	if other.MonthNames != nil {
+		m.MonthNames = other.MonthNames
+	}
+	if other.CurrencyFormat != "" {
+		m.CurrencyFormat = other.CurrencyFormat
+	}
+	if other.CurrencySymbols != nil {
+		m.CurrencySymbols = other.CurrencySymbols
+	}
+	if other.ThousandsSeparator != nil {
+		m.ThousandsSeparator = *other.ThousandsSeparator
+	}
+	if other.DecimalSeparator != nil {
+		m.DecimalSeparator = *other.DecimalSeparator
+	}
+	for k, v := range other.Texts {
+		m.Texts[k] = v
+	}
+	return nil
+}
+
+// Text formats the message of the key with args. Unknown keys are returned
+// as is so that a missing translation is visible in the report.
+func (m *Messages) Text(key string, args ...interface{}) string {
+	text, ok := m.Texts[key]
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+func (m *Messages) MonthName(month time.Month) string {
+	return m.MonthNames[month-1]
+}
+
+// FormatDate formats t with the date format of the locale. Full English month
+// names in the result are replaced with the month names of the locale.
+func (m *Messages) FormatDate(t time.Time) string {
+	s := t.Format(m.DateFormat)
+	if strings.Contains(m.DateFormat, "January") {
+		s = strings.Replace(s, t.Month().String(), m.MonthName(t.Month()), 1)
+	}
+	return s
+}
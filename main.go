@@ -7,6 +7,7 @@ import (
 	"image/color"
 	"log"
 	"log/slog"
+	"math"
 	"os"
 	"sort"
 	"strconv"
@@ -17,25 +18,40 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
-	organizationTypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
 	"gonum.org/v1/plot/vg/draw"
-	"gonum.org/v1/plot/vg/vgimg"
 )
 
 const (
-	UnblendedCost = "UnblendedCost"
+	UnblendedCost    = "UnblendedCost"
+	BlendedCost      = "BlendedCost"
+	AmortizedCost    = "AmortizedCost"
+	NetUnblendedCost = "NetUnblendedCost"
+	NetAmortizedCost = "NetAmortizedCost"
 )
 
+// forecastMetrics maps the metrics of GetCostAndUsage to the ones of GetCostForecast.
+var forecastMetrics = map[string]types.Metric{
+	UnblendedCost:    types.MetricUnblendedCost,
+	BlendedCost:      types.MetricBlendedCost,
+	AmortizedCost:    types.MetricAmortizedCost,
+	NetUnblendedCost: types.MetricNetUnblendedCost,
+	NetAmortizedCost: types.MetricNetAmortizedCost,
+}
+
 type Cost struct {
-	AccountId   string
-	AccountName string
-	ServiceName string
-	Amount      float64
-	TimePeriod  string
+	AccountId   string  `json:"account_id,omitempty"`
+	AccountName string  `json:"account_name,omitempty"`
+	ServiceName string  `json:"service,omitempty"`
+	Region      string  `json:"region,omitempty"`
+	RecordType  string  `json:"record_type,omitempty"`
+	Amount      float64 `json:"amount"`
+	TimePeriod  string  `json:"time_period,omitempty"`
+	// Estimated tells that the amount is not finalized and may still change.
+	Estimated bool `json:"estimated,omitempty"`
 }
 
 func getLogLevel() slog.Level {
@@ -56,7 +72,8 @@ func getLogLevel() slog.Level {
 
 func main() {
 	// ロガーの初期化
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	// 出力をパイプで扱えるように、ログは標準エラー出力に書き出す
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: getLogLevel(),
 	}))
 	slog.SetDefault(logger)
@@ -103,6 +120,24 @@ func disableForecast() bool {
 	return disableForecast
 }
 
+func outputFormat() string {
+	format := os.Getenv("OUTPUT_FORMAT")
+	if format == "" {
+		format = OutputFormatText
+	}
+	return format
+}
+
+func outputPath() string {
+	return os.Getenv("OUTPUT_PATH")
+}
+
+// historyDate is the report day, in the form of "2006-01-02", of a stored
+// snapshot to output instead of querying Cost Explorer.
+func historyDate() string {
+	return os.Getenv("HISTORY_DATE")
+}
+
 type Bar struct {
 	AccountName string
 	BarChart    plotter.BarChart
@@ -111,6 +146,10 @@ type Bar struct {
 func handler(ev events.CloudWatchEvent) error {
 	handlerStart := time.Now()
 
+	if err := validateOutputFormat(outputFormat()); err != nil {
+		return err
+	}
+
 	now := time.Now()
 	slog.Debug("loading AWS config")
 	configStart := time.Now()
@@ -128,9 +167,30 @@ func handler(ev events.CloudWatchEvent) error {
 	}
 	slog.Debug("application config loaded", "duration", time.Since(cfgStart))
 
+	messages, err := NewMessages(cfg)
+	if err != nil {
+		return err
+	}
+	currency, err := NewCurrency(cfg, messages)
+	if err != nil {
+		return err
+	}
+	textRenderer, err := NewTextRenderer(cfg, messages, currency)
+	if err != nil {
+		return err
+	}
+	history := NewCostHistory(cfg, awsConfig)
+	if dryRun() {
+		// A dry run must not overwrite the history of the real runs.
+		history = history.ReadOnly()
+	}
+	if historyDate() != "" {
+		return outputSnapshot(history, historyDate(), textRenderer, currency)
+	}
+
 	slog.Debug("getting forecasts")
 	forecastStart := time.Now()
-	forecastsPeriod, forecasts, err := getForecasts(&awsConfig, now)
+	forecastsPeriod, forecasts, err := getForecasts(cfg, &awsConfig, now)
 	if err != nil {
 		slog.Error("failed to get forecasts", "error", err)
 	}
@@ -138,25 +198,137 @@ func handler(ev events.CloudWatchEvent) error {
 
 	slog.Debug("calculating costs")
 	costsStart := time.Now()
-	costCalculator := NewCostOfTwoDaysAgo(&awsConfig, now)
+	costCalculator := NewCostOfTwoDaysAgo(cfg, &awsConfig, now)
 	costs, err := costCalculator.GetCosts()
 	if err != nil {
 		return err
 	}
+	var regionCosts []Cost
+	if cfg.RegionReport {
+		regionCosts, err = costCalculator.GetCostsByRegion()
+		if err != nil {
+			return err
+		}
+	}
+	var recordTypeCosts []Cost
+	if cfg.RecordTypeBreakdown {
+		recordTypeCosts, err = costCalculator.GetCostsByRecordType()
+		if err != nil {
+			return err
+		}
+	}
 	slog.Debug("costs calculation completed", "duration", time.Since(costsStart))
 
 	slog.Debug("rendering cost graph")
 	graphStart := time.Now()
-	costGraphRenderer := NewCostGraphRenderer(cfg, &awsConfig, now)
-	accounts, costsForGraph, err := costGraphRenderer.GetCosts()
+	costGraphRenderer := NewCostGraphRenderer(cfg, &awsConfig, now).WithHistory(history)
+	costsForGraph, err := costGraphRenderer.GetCosts()
 	if err != nil {
 		return err
 	}
-	colors, err := generateColors(cfg.Colors)
+	var forecastsForGraph []DailyForecast
+	if !disableForecast() && cfg.HasChart(ChartAccount) && cfg.GraphGranularity() == types.GranularityDaily && costGraphRenderer.EndsAtLatestDay() {
+		forecastsForGraph, err = costGraphRenderer.GetForecast()
+		if err != nil {
+			slog.Error("failed to get daily forecast", "error", err)
+		}
+	}
+	var lastYearCostsForGraph []DailyCosts
+	if cfg.HasChart(ChartCumulative) {
+		lastYearCostsForGraph, err = costGraphRenderer.GetCostsOfMonthLastYear()
+		if err != nil {
+			slog.Error("failed to get costs of the same month last year", "error", err)
+		}
+	}
+	annotations, err := collectAnnotations(cfg, &awsConfig, costGraphRenderer.Period())
 	if err != nil {
 		return err
 	}
-	graph, err := drawStackedBarChart(costGraphRenderer.Period(), accounts, costsForGraph, colors)
+	var serviceCostsForGraph []DailyCosts
+	if cfg.HasChart(ChartService) {
+		serviceCostsForGraph, err = costGraphRenderer.GetCostsByService()
+		if err != nil {
+			return err
+		}
+	}
+	var regionCostsForGraph []DailyCosts
+	if cfg.HasChart(ChartRegion) {
+		regionCostsForGraph, err = costGraphRenderer.GetCostsByRegion()
+		if err != nil {
+			return err
+		}
+	}
+
+	var commitments []Commitment
+	if cfg.Commitments {
+		commitments, err = NewCostCommitments(cfg, &awsConfig, now).GetCommitments()
+		if err != nil {
+			slog.Error("failed to get commitments", "error", err)
+		}
+	}
+
+	var recommendations []Recommendation
+	if cfg.IsRecommendationDay(now) {
+		recommendations, err = NewCostRecommendations(cfg, &awsConfig, now).GetRecommendations()
+		if err != nil {
+			slog.Error("failed to get recommendations", "error", err)
+		}
+		recommendationAccounts(recommendations, costs)
+	}
+
+	var drillDowns []DrillDown
+	if cfg.DrillDown {
+		drillDowns, err = NewCostDrillDown(cfg, &awsConfig, now).GetDrillDowns()
+		if err != nil {
+			slog.Error("failed to drill down services", "error", err)
+		}
+	}
+
+	usdReport := &Report{
+		Period:             costCalculator.Period(),
+		Costs:              costs,
+		ForecastPeriod:     forecastsPeriod,
+		Forecasts:          forecasts,
+		DailyCosts:         costsForGraph,
+		DailyForecasts:     forecastsForGraph,
+		ServiceDailyCosts:  serviceCostsForGraph,
+		RegionCosts:        regionCosts,
+		RecordTypeCosts:    recordTypeCosts,
+		RegionDailyCosts:   regionCostsForGraph,
+		Commitments:        commitments,
+		Recommendations:    recommendations,
+		DrillDowns:         drillDowns,
+		Annotations:        annotations,
+		Month:              costGraphRenderer.Month(),
+		LastYearDailyCosts: lastYearCostsForGraph,
+		Metric:             cfg.CostMetric(),
+		Gross:              cfg.Gross,
+		GroupBy:            groupHeader(cfg.ReportGroupBy()),
+	}
+	if history != nil {
+		usdReport.PreviousForecast, err = history.PreviousForecast(usdReport)
+		if err != nil {
+			slog.Error("failed to get the previous forecast", "error", err)
+		}
+		if !dryRun() {
+			if err := history.SaveSnapshot(usdReport, now); err != nil {
+				slog.Error("failed to save the snapshot", "error", err)
+			}
+		}
+	}
+	// Amounts are converted to the display currency once here, so that the
+	// text, the graph and the other outputs show the same numbers.
+	report := usdReport.ConvertTo(currency)
+	report.Messages = messages
+	if accounts, services := cfg.ServiceBreakdownSize(); accounts > 0 {
+		report.ServiceBreakdown = serviceBreakdown(report.Costs, accounts, services)
+	}
+
+	chartTarget := ChartTargetSlack
+	if dryRun() {
+		chartTarget = ChartTargetFile
+	}
+	charts, err := renderCharts(cfg, messages, currency, costGraphRenderer.Period(), report, chartTarget)
 	if err != nil {
 		return err
 	}
@@ -164,7 +336,11 @@ func handler(ev events.CloudWatchEvent) error {
 
 	slog.Debug("rendering text")
 	textStart := time.Now()
-	text, err := renderText(forecasts, costs, forecastsPeriod, costCalculator.Period())
+	data, err := reportData(report)
+	if err != nil {
+		return err
+	}
+	text, err := textRenderer.Render(data)
 	if err != nil {
 		log.Fatalf("failed to render: %v", err)
 		return err
@@ -172,11 +348,16 @@ func handler(ev events.CloudWatchEvent) error {
 	slog.Debug("text rendering completed", "duration", time.Since(textStart))
 
 	if dryRun() {
-		fmt.Println(text)
+		if err := writeOutput(outputFormat(), outputPath(), report, text); err != nil {
+			return err
+		}
+		if err := writeCharts("./tmp", charts); err != nil {
+			return err
+		}
 	} else {
 		slog.Debug("posting to Slack")
 		slackStart := time.Now()
-		err = postToSlack(cfg, text, graph)
+		err = postToSlack(cfg, text, charts)
 		if err != nil {
 			log.Fatalf("failed to post to slack: %v", err)
 			return err
@@ -188,9 +369,38 @@ func handler(ev events.CloudWatchEvent) error {
 	return nil
 }
 
-func getForecasts(awsConfig *aws.Config, now time.Time) (*types.DateInterval, map[string]float64, error) {
+// outputSnapshot writes the report stored in the history for the date.
+func outputSnapshot(history *CostHistory, date string, textRenderer *TextRenderer, currency *Currency) error {
+	if history == nil {
+		return fmt.Errorf("HISTORY_DATE requires History in the config")
+	}
+	snapshot, err := history.Snapshot(date)
+	if err != nil {
+		return err
+	}
+	usdReport, err := snapshot.Report()
+	if err != nil {
+		return err
+	}
+	if usdReport.PreviousForecast, err = history.PreviousForecast(usdReport); err != nil {
+		slog.Error("failed to get the previous forecast", "error", err)
+	}
+	report := usdReport.ConvertTo(currency)
+	report.Messages = textRenderer.messages
+	data, err := reportData(report)
+	if err != nil {
+		return err
+	}
+	text, err := textRenderer.Render(data)
+	if err != nil {
+		return err
+	}
+	return writeOutput(outputFormat(), outputPath(), report, text)
+}
+
+func getForecasts(cfg *Config, awsConfig *aws.Config, now time.Time) (*types.DateInterval, map[string]float64, error) {
 	if !disableForecast() {
-		forecastCalculator := NewForecastsOfCurrentMonth(awsConfig, now)
+		forecastCalculator := NewForecastsOfCurrentMonth(cfg, awsConfig, now)
 		forecasts, err := forecastCalculator.GetForecasts()
 		if err != nil {
 			return forecastCalculator.Period(), forecasts, err
@@ -200,24 +410,52 @@ func getForecasts(awsConfig *aws.Config, now time.Time) (*types.DateInterval, ma
 	return nil, nil, nil
 }
 
+// ForecastPredictionIntervalLevel is the confidence level, in percent, of the
+// prediction interval of the daily forecast.
+const ForecastPredictionIntervalLevel = 80
+
+// DailyForecast is the forecast of the total costs of a day, with the bounds
+// of its prediction interval.
+type DailyForecast struct {
+	Date  *time.Time
+	Mean  float64
+	Lower float64
+	Upper float64
+}
+
 type DailyCosts struct {
 	Date  *time.Time
 	Costs []Cost
+	// Estimated tells that the costs of the day are not finalized.
+	Estimated bool
 }
 
-func drawStackedBarChart(period *types.DateInterval, accounts []organizationTypes.Account, dailyCosts []DailyCosts, colors []color.Color) (*bytes.Buffer, error) {
+func drawStackedBarChart(opts chartOptions, dailyCosts []DailyCosts) (*bytes.Buffer, error) {
 	p := plot.New()
-	p.Title.Text = "AWS Daily Costs (3 months)"
-	p.Y.Label.Text = "Costs (USD)"
+	p.Title.Text = opts.Title
+	p.Y.Label.Text = fmt.Sprintf("Costs (%s)", opts.Currency.Code)
+	p.Y.Tick.Marker = currencyTicks{opts.Currency}
 	p.Y.AutoRescale = true
 	p.Legend.Top = true
 	p.Legend.Left = false
 	p.Legend.XOffs = 200
 	p.Add(plotter.NewGrid())
 
+	dailyCosts = aggregateCosts(dailyCosts, opts.Granularity)
+	if opts.Granularity == GranularityWeekly || opts.Granularity == types.GranularityMonthly {
+		opts.Forecasts = nil
+	}
+	gap := forecastGap(dailyCosts, opts.Forecasts)
 	maxAmount := 0.0
-	nominals := []string{}
+	nominals := periodLabels(dailyCosts, opts.Granularity)
+	width := barWidth(opts.Image, len(dailyCosts)+len(gap)+len(opts.Forecasts))
 	costsByAccount := map[string]plotter.Values{}
+	limit := opts.Limit
+	if limit == 0 {
+		limit = defaultSeriesLimit(dailyCosts, opts.SeriesName, len(opts.Colors))
+	}
+	names, seriesOf := chartSeries(dailyCosts, opts.SeriesName, limit)
+	colors := seriesColors(names, seriesIds(dailyCosts, opts.SeriesName), opts.Colors, opts.SeriesColors)
 
 	for _, dailyCost := range dailyCosts {
 		// Calculate max amount
@@ -229,51 +467,96 @@ func drawStackedBarChart(period *types.DateInterval, accounts []organizationType
 			maxAmount = dailyMax
 		}
 
-		// Calculate nominals
-		if dailyCost.Date.Day() == 1 || dailyCost.Date.Format("2006-01-02") == *period.End {
-			nominals = append(nominals, dailyCost.Date.Format("2006-01-02"))
+		// Calculate costs by account. Days without costs of an account are
+		// filled with zero so that the bars of all accounts stay aligned.
+		amounts := map[string]float64{}
+		for _, cost := range dailyCost.Costs {
+			amounts[seriesOf[opts.SeriesName(cost)]] += cost.Amount
+		}
+		for _, name := range names {
+			costsByAccount[name] = append(costsByAccount[name], amounts[name])
+		}
+	}
+
+	// The forecast follows the last actual day. Actual series are padded with
+	// zero so that all bars share the same positions.
+	lastActual := len(dailyCosts) - 1
+	forecastValues := make(plotter.Values, len(dailyCosts))
+	band := plotter.XYs{}
+	if len(opts.Forecasts) > 0 && len(nominals) > 0 && dailyCosts[len(dailyCosts)-1].Date.Day() != 1 {
+		// The last actual day is not the end of the axis anymore.
+		nominals[len(nominals)-1] = ""
+	}
+	for _, day := range gap {
+		if day.Day() == 1 {
+			nominals = append(nominals, day.Format("2006-01-02"))
 		} else {
 			nominals = append(nominals, "")
 		}
-
-		// Calculate costs by account
-		for _, cost := range dailyCost.Costs {
-			costsByAccount[cost.AccountName] = append(costsByAccount[cost.AccountName], cost.Amount)
+		for _, name := range names {
+			costsByAccount[name] = append(costsByAccount[name], 0)
 		}
+		forecastValues = append(forecastValues, 0)
+	}
+	for i, forecast := range opts.Forecasts {
+		maxAmount = math.Max(maxAmount, math.Max(forecast.Mean, forecast.Upper))
+		if i == len(opts.Forecasts)-1 || forecast.Date.Day() == 1 {
+			nominals = append(nominals, forecast.Date.Format("2006-01-02"))
+		} else {
+			nominals = append(nominals, "")
+		}
+		for _, name := range names {
+			costsByAccount[name] = append(costsByAccount[name], 0)
+		}
+		forecastValues = append(forecastValues, forecast.Mean)
+		band = append(band, plotter.XY{X: float64(len(forecastValues) - 1), Y: forecast.Upper})
+	}
+	for i := len(opts.Forecasts) - 1; i >= 0; i-- {
+		band = append(band, plotter.XY{X: float64(len(dailyCosts) + len(gap) + i), Y: opts.Forecasts[i].Lower})
 	}
 	p.Y.Max = maxAmount * 1.5
 	p.NominalX(nominals...)
 
 	bars := []Bar{}
-	for _, account := range accounts {
-		if costsByAccount[*account.Name] != nil && costsByAccount[*account.Name].Len() > 0 {
-			bar, err := plotter.NewBarChart(costsByAccount[*account.Name], vg.Points(5))
+	for _, name := range names {
+		if costsByAccount[name].Len() > 0 {
+			bar, err := plotter.NewBarChart(costsByAccount[name], width)
 			if err != nil {
 				return nil, err
 			}
 			bar.LineStyle.Width = vg.Length(0)
-			bars = append(bars, Bar{*account.Name, *bar})
+			bars = append(bars, Bar{name, *bar})
 		}
 	}
 
-	// Sort by the last value (amount) of the bar chart
+	// Sort by the last actual value (amount) of the bar chart
 	sort.SliceStable(bars, func(i, j int) bool {
-		ilen := len(bars[i].BarChart.Values) - 1
-		jlen := len(bars[j].BarChart.Values) - 1
-		return bars[i].BarChart.Values[ilen] < bars[j].BarChart.Values[jlen]
+		return bars[i].BarChart.Values[lastActual] < bars[j].BarChart.Values[lastActual]
 	})
 
 	// Render legends
-	l := plot.NewLegend()
-	l.Top = true
-	l.YOffs = -p.Title.TextStyle.FontExtents().Height
+	l := newLegend(p)
 	for i, _ := range bars {
-		bars[i].BarChart.Color = colors[i]
+		bars[i].BarChart.Color = colors[bars[i].AccountName]
 		l.Add(bars[i].AccountName, &bars[i].BarChart)
 	}
-	img := vgimg.New(1000, 300)
-	dc := draw.New(img)
-	l.Draw(dc)
+	if len(opts.Forecasts) > 0 {
+		polygon, err := plotter.NewPolygon(band)
+		if err != nil {
+			return nil, err
+		}
+		polygon.Color = ForecastBandColor
+		polygon.LineStyle.Width = vg.Length(0)
+		forecastBar, err := plotter.NewBarChart(forecastValues, width)
+		if err != nil {
+			return nil, err
+		}
+		forecastBar.Color = ForecastColor
+		forecastBar.LineStyle.Width = vg.Length(0)
+		p.Add(polygon, forecastBar)
+		l.Add("Forecast", forecastBar)
+		l.Add(fmt.Sprintf("Forecast (%d%% interval)", ForecastPredictionIntervalLevel), polygon)
+	}
 
 	// Render bar charts
 	for i, _ := range bars {
@@ -282,58 +565,127 @@ func drawStackedBarChart(period *types.DateInterval, accounts []organizationType
 		}
 		p.Add(&bars[i].BarChart)
 	}
+
+	// Fade the bars of the days that are not finalized.
+	estimated, err := estimatedBars(dailyCosts, len(forecastValues), width)
+	if err != nil {
+		return nil, err
+	}
+	if estimated != nil {
+		p.Add(estimated)
+		l.Add("Estimated", estimated)
+	}
+
+	// Render annotations over the bars
+	positions := map[string]int{}
+	for i, dailyCost := range dailyCosts {
+		end := periodEnd(*dailyCost.Date, opts.Granularity)
+		for d := *dailyCost.Date; d.Before(end); d = d.AddDate(0, 0, 1) {
+			positions[d.Format("2006-01-02")] = i
+		}
+	}
+	for i, day := range gap {
+		positions[day.Format("2006-01-02")] = len(dailyCosts) + i
+	}
+	for i, forecast := range opts.Forecasts {
+		positions[forecast.Date.Format("2006-01-02")] = len(dailyCosts) + len(gap) + i
+	}
+	markers, err := annotationMarkers(opts.Annotations, positions, maxAmount*1.3)
+	if err != nil {
+		return nil, err
+	}
+	p.Add(markers...)
+	return writeChart(p, l, opts.Image)
+}
+
+// forecastGap returns the days between the last actual day and the first
+// forecast day, such as yesterday whose costs are not reported yet. They are
+// left empty so that the forecast is drawn on its own dates.
+func forecastGap(dailyCosts []DailyCosts, forecasts []DailyForecast) []time.Time {
+	if len(dailyCosts) == 0 || len(forecasts) == 0 {
+		return nil
+	}
+	gap := []time.Time{}
+	for day := dailyCosts[len(dailyCosts)-1].Date.AddDate(0, 0, 1); day.Before(*forecasts[0].Date); day = day.AddDate(0, 0, 1) {
+		gap = append(gap, day)
+	}
+	return gap
+}
+
+// newChartPlot returns a plot with the title and the currency axis of the chart.
+func newChartPlot(opts chartOptions) *plot.Plot {
+	p := plot.New()
+	p.Title.Text = opts.Title
+	p.Y.Label.Text = fmt.Sprintf("Costs (%s)", opts.Currency.Code)
+	p.Y.Tick.Marker = currencyTicks{opts.Currency}
+	p.Add(plotter.NewGrid())
+	return p
+}
+
+func newLegend(p *plot.Plot) plot.Legend {
+	l := plot.NewLegend()
+	l.Top = true
+	l.YOffs = -p.Title.TextStyle.FontExtents().Height
+	return l
+}
+
+// writeChart draws the plot with the legend on its right side, and returns
+// the image in the format of the chart image.
+func writeChart(p *plot.Plot, l plot.Legend, image ChartImage) (*bytes.Buffer, error) {
+	img, err := image.newCanvas()
+	if err != nil {
+		return nil, err
+	}
+	dc := draw.New(img)
+	l.Draw(dc)
+
 	r := l.Rectangle(dc)
 	legendWidth := r.Max.X - r.Min.X
 	dc = draw.Crop(dc, 0, -legendWidth-vg.Millimeter, 0, 0)
 	p.Draw(dc)
 
-	// Write charts to file or buffer
-	png := vgimg.PngCanvas{Canvas: img}
-	if dryRun() {
-		w, err := os.Create("./tmp/timeseries.png")
-		if err != nil {
-			return nil, err
-		}
-		if _, err = png.WriteTo(w); err != nil {
-			return nil, err
-		}
-		return nil, nil
-	} else {
-		buffer := bytes.NewBuffer([]byte{})
-		_, err := png.WriteTo(buffer)
-		if err != nil {
-			return nil, err
-		}
-		return buffer, nil
+	// Write charts to buffer
+	buffer := bytes.NewBuffer([]byte{})
+	if _, err := img.WriteTo(buffer); err != nil {
+		return nil, err
 	}
+	return buffer, nil
 }
 
 func generateColors(colorConfig []string) ([]color.Color, error) {
 	colors := []color.Color{}
 
-	if colorConfig == nil {
+	if len(colorConfig) == 0 {
 		return append(plotutil.SoftColors, plotutil.DarkColors...), nil
 	}
 
 	for _, hex := range colorConfig {
-		if len(hex) != 7 || hex[0] != '#' {
-			return nil, fmt.Errorf("invalid hex color format")
-		}
-		r, err := strconv.ParseUint(hex[1:3], 16, 8)
+		c, err := parseHexColor(hex)
 		if err != nil {
 			return nil, err
 		}
+		colors = append(colors, c)
+	}
+	return colors, nil
+}
 
-		g, err := strconv.ParseUint(hex[3:5], 16, 8)
-		if err != nil {
-			return nil, err
-		}
+func parseHexColor(hex string) (color.Color, error) {
+	if len(hex) != 7 || hex[0] != '#' {
+		return nil, fmt.Errorf("invalid hex color format")
+	}
+	r, err := strconv.ParseUint(hex[1:3], 16, 8)
+	if err != nil {
+		return nil, err
+	}
 
-		b, err := strconv.ParseUint(hex[5:7], 16, 8)
-		if err != nil {
-			return nil, err
-		}
-		colors = append(colors, color.RGBA{uint8(r), uint8(g), uint8(b), 255})
+	g, err := strconv.ParseUint(hex[3:5], 16, 8)
+	if err != nil {
+		return nil, err
 	}
-	return colors, nil
+
+	b, err := strconv.ParseUint(hex[5:7], 16, 8)
+	if err != nil {
+		return nil, err
+	}
+	return color.RGBA{uint8(r), uint8(g), uint8(b), 255}, nil
 }
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"hash/fnv"
+	"image/color"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -71,11 +85,13 @@ func Test_transformToCosts(t *testing.T) {
 			},
 			want: []Cost{
 				{
+					AccountId:   "123",
 					AccountName: "foo",
 					ServiceName: "svc1",
 					Amount:      1.1,
 				},
 				{
+					AccountId:   "456",
 					AccountName: "bar",
 					ServiceName: "svc1",
 					Amount:      3.2,
@@ -86,7 +102,7 @@ func Test_transformToCosts(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := NewCostOfTwoDaysAgo(nil, time.Now())
+			c := NewCostOfTwoDaysAgo(&Config{}, nil, time.Now())
 			got, err := c.transformToCosts(tt.args.costAndUsage)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("transformToCosts() error = %v, wantErr %v", err, tt.wantErr)
@@ -141,7 +157,7 @@ func Test_renderText(t *testing.T) {
 				},
 			},
 			want: fmt.Sprintf(`
-2022-11-23の合計料金: 4.30 USD (11月の料金予測: 12.80 USD)
+2022-11-23の合計料金 (UnblendedCost): 4.30 USD (11月の料金予測: 12.80 USD)
 
 アカウント毎の料金:
 
@@ -155,9 +171,9 @@ func Test_renderText(t *testing.T) {
 上位5サービス:
 
 %s
-   ACCOUNT   COST(USD)  
-  service_a       3.20  
-  service_a       1.10  
+   SERVICE    ACCOUNT   COST(USD)  
+  service_a  account_2       3.20  
+  service_a  account_1       1.10  
 
 %s
 `, codeFence, codeFence, codeFence, codeFence),
@@ -166,9 +182,18 @@ func Test_renderText(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := renderText(tt.args.forecasts, tt.args.costs, tt.args.periodForForecasts, tt.args.period)
+			renderer, err := NewTextRenderer(&Config{}, defaultMessages(), defaultCurrency())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			data, err := templateData(tt.args.forecasts, tt.args.costs, tt.args.periodForForecasts, tt.args.period)
+			if err == nil {
+				data.Metric = UnblendedCost
+				got, err = renderer.Render(data)
+			}
 			if (err != nil) != tt.wantErr {
-				t.Errorf("renderText() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Render() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if got != tt.want {
@@ -180,8 +205,2150 @@ func Test_renderText(t *testing.T) {
 				if err != nil {
 					t.Errorf("error = %v", err)
 				}
-				t.Errorf("renderText() got = %v, want %v", got, tt.want)
+				t.Errorf("Render() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_renderOutput(t *testing.T) {
+	date := time.Date(2022, 11, 23, 0, 0, 0, 0, time.UTC)
+	report := &Report{
+		Period: &types.DateInterval{
+			Start: aws.String("2022-11-23"),
+			End:   aws.String("2022-11-24"),
+		},
+		Costs: []Cost{
+			{AccountId: "123", AccountName: "account_1", ServiceName: "service_a", Amount: 1.1},
+		},
+		ForecastPeriod: &types.DateInterval{
+			Start: aws.String("2022-11-25"),
+			End:   aws.String("2022-12-01"),
+		},
+		Forecasts: map[string]float64{
+			"account_1": 5.1,
+		},
+		DailyCosts: []DailyCosts{
+			{Date: &date, Costs: []Cost{{AccountName: "account_1", Amount: 1.1}}},
+		},
+		Metric: UnblendedCost,
+	}
+	tests := []struct {
+		name    string
+		format  string
+		locale  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "csv",
+			format: OutputFormatCSV,
+			want: `record,date,account_id,account_name,service,amount,currency
+cost,2022-11-23,123,account_1,service_a,1.10,USD
+forecast,2022-12-01,,account_1,,5.10,USD
+daily,2022-11-23,,account_1,,1.10,USD
+`,
+		},
+		{
+			name:   "markdown",
+			format: OutputFormatMarkdown,
+			want: `# 2022-11-23のAWS料金
+
+2022-11-23の合計料金 (UnblendedCost): 1.10 USD
+
+## アカウント毎の料金
+
+| Account | Cost(USD) | Forecast |
+| --- | ---: | ---: |
+| account_1 | 1.10 | 5.10 |
+
+## 上位5サービス
+
+| Service | Account | Cost(USD) |
+| --- | --- | ---: |
+| service_a | account_1 | 1.10 |
+
+## 日次料金
+
+| Date | Cost(USD) |
+| --- | ---: |
+| 2022-11-23 | 1.10 |
+`,
+		},
+		{
+			name:   "markdown en",
+			format: OutputFormatMarkdown,
+			locale: "en",
+			want: `# AWS costs of November 23, 2022
+
+Total cost on November 23, 2022 (UnblendedCost): 1.10 USD
+
+## Costs by account
+
+| Account | Cost(USD) | Forecast |
+| --- | ---: | ---: |
+| account_1 | 1.10 | 5.10 |
+
+## Top 5 services
+
+| Service | Account | Cost(USD) |
+| --- | --- | ---: |
+| service_a | account_1 | 1.10 |
+
+## Daily costs
+
+| Date | Cost(USD) |
+| --- | ---: |
+| 2022-11-23 | 1.10 |
+`,
+		},
+		{
+			name:   "html en",
+			format: OutputFormatHTML,
+			locale: "en",
+			want: `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>AWS costs of November 23, 2022</title>
+</head>
+<body>
+<h1>AWS costs of November 23, 2022</h1>
+<p>Total cost on November 23, 2022 (UnblendedCost): 1.10 USD</p>
+<h2>Costs by account</h2>
+<table>
+<tr><th>Account</th><th>Cost(USD)</th><th>Forecast</th></tr>
+<tr><td>account_1</td><td>1.10</td><td>5.10</td></tr>
+</table>
+<h2>Top 5 services</h2>
+<table>
+<tr><th>Service</th><th>Account</th><th>Cost(USD)</th></tr>
+<tr><td>service_a</td><td>account_1</td><td>1.10</td></tr>
+</table>
+<h2>Daily costs</h2>
+<table>
+<tr><th>Date</th><th>Cost(USD)</th></tr>
+<tr><td>2022-11-23</td><td>1.10</td></tr>
+</table>
+</body>
+</html>
+`,
+		},
+		{
+			name:    "unknown",
+			format:  "yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := *report
+			if tt.locale != "" {
+				messages, err := NewMessages(&Config{Locale: tt.locale})
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Messages = messages
+			}
+			b := new(strings.Builder)
+			err := renderOutput(b, tt.format, &r, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderOutput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("renderOutput() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_NewTextRenderer(t *testing.T) {
+	data := &TemplateData{
+		Date: "2022-11-23",
+		Costs: []Cost{
+			{AccountName: "account_1", ServiceName: "service_a", Amount: 1.1},
+			{AccountName: "account_2", ServiceName: "service_b", Amount: 3.2},
+			{AccountName: "account_2", ServiceName: "service_c", Amount: 0.5},
+		},
+	}
+	tests := []struct {
+		name    string
+		cfg     *Config
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "inline template with helpers",
+			cfg: &Config{
+				Template: `{{ .Date }} {{ sum .Costs | formatCurrency }}
+{{ range sortByAmount .Costs | top 2 }}{{ padRight 10 .ServiceName }}|{{ padLeft 6 (formatAmount .Amount) }}
+{{ end }}{{ formatAmount (percentChange 2 3) }}`,
+			},
+			want: `2022-11-23 4.80 USD
+service_b |  3.20
+service_a |  1.10
+50.00`,
+		},
+		{
+			name:    "syntax error",
+			cfg:     &Config{Template: `{{ .Date `},
+			wantErr: true,
+		},
+		{
+			name: "index into costs",
+			cfg:  &Config{Template: `{{ (index .Costs 0).AccountName }}`},
+			want: "account_1",
+		},
+		{
+			name:    "unknown field",
+			cfg:     &Config{Template: `{{ .NoSuchField }}`},
+			wantErr: true,
+		},
+		{
+			name:    "template and template file",
+			cfg:     &Config{Template: `{{ .Date }}`, TemplateFile: "report.tmpl"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewTextRenderer(tt.cfg, defaultMessages(), defaultCurrency())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTextRenderer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			got, err := r.Render(data)
+			if err != nil {
+				t.Errorf("Render() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Render() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_NewMessages(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(dir+"/fr.json", []byte(`{
+  "date_format": "2 January 2006",
+  "month_names": ["janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"],
+  "messages": {"costs_by_account": "Coûts par compte"}
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2022, 11, 23, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		cfg      *Config
+		wantDate string
+		wantText string
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			cfg:      &Config{},
+			wantDate: "2022-11-23",
+			wantText: "アカウント毎の料金",
+		},
+		{
+			name:     "en",
+			cfg:      &Config{Locale: "en"},
+			wantDate: "November 23, 2022",
+			wantText: "Costs by account",
+		},
+		{
+			name:     "additional locale",
+			cfg:      &Config{Locale: "fr", LocaleDir: dir},
+			wantDate: "23 novembre 2022",
+			wantText: "Coûts par compte",
+		},
+		{
+			name:    "unknown locale",
+			cfg:     &Config{Locale: "de", LocaleDir: dir},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMessages(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewMessages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got := m.FormatDate(date); got != tt.wantDate {
+				t.Errorf("FormatDate() got = %v, want %v", got, tt.wantDate)
+			}
+			if got := m.Text("costs_by_account"); got != tt.wantText {
+				t.Errorf("Text() got = %v, want %v", got, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestCurrency_Format(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/rates.json", []byte(`{"JPY": 150, "EUR": 0.9}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		cfg     *Config
+		amount  float64
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "default",
+			cfg:    &Config{},
+			amount: 1234.5,
+			want:   "1,234.50 USD",
+		},
+		{
+			name:   "en",
+			cfg:    &Config{Locale: "en"},
+			amount: -0.5,
+			want:   "-$0.50",
+		},
+		{
+			name:   "negative yen",
+			cfg:    &Config{Locale: "en", Currency: &CurrencyConfig{Code: "JPY", Rate: 1}},
+			amount: -50,
+			want:   "-¥50",
+		},
+		{
+			name:   "static rate",
+			cfg:    &Config{Currency: &CurrencyConfig{Code: "JPY", Rate: 150, Symbol: "円"}},
+			amount: 1234.5,
+			want:   "185,175 円",
+		},
+		{
+			name:   "rates file",
+			cfg:    &Config{Locale: "en", Currency: &CurrencyConfig{Code: "EUR", RatesFile: dir + "/rates.json"}},
+			amount: 1000,
+			want:   "€900.00",
+		},
+		{
+			name:    "no rate",
+			cfg:     &Config{Currency: &CurrencyConfig{Code: "GBP", RatesFile: dir + "/rates.json"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := NewMessages(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := NewCurrency(tt.cfg, messages)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewCurrency() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got := c.Format(c.Convert(tt.amount)); got != tt.want {
+				t.Errorf("Format() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_CostMetric(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{
+			name: "default",
+			cfg:  &Config{},
+			want: UnblendedCost,
+		},
+		{
+			name: "GetCostAndUsageInput",
+			cfg:  &Config{GetCostAndUsageInput: &costexplorer.GetCostAndUsageInput{Metrics: []string{AmortizedCost}}},
+			want: AmortizedCost,
+		},
+		{
+			name: "Metric takes precedence",
+			cfg: &Config{
+				Metric:               NetAmortizedCost,
+				GetCostAndUsageInput: &costexplorer.GetCostAndUsageInput{Metrics: []string{AmortizedCost}},
+			},
+			want: NetAmortizedCost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.CostMetric(); got != tt.want {
+				t.Errorf("CostMetric() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reportFilterIsSharedByAllQueries(t *testing.T) {
+	filter := &types.Expression{
+		Dimensions: &types.DimensionValues{
+			Key:    types.DimensionRecordType,
+			Values: []string{"Usage"},
+		},
+	}
+	accountFilter := types.Expression{
+		Dimensions: &types.DimensionValues{
+			Key:    "LINKED_ACCOUNT",
+			Values: []string{"123"},
+		},
+	}
+	noCredits := types.Expression{
+		Not: &types.Expression{
+			Dimensions: &types.DimensionValues{
+				Key:    types.DimensionRecordType,
+				Values: []string{"Credit", "Refund"},
+			},
+		},
+	}
+	now := time.Date(2022, 11, 25, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		cfg          *Config
+		want         *types.Expression
+		wantForecast *types.Expression
+	}{
+		{
+			name: "default excludes tax",
+			cfg:  &Config{},
+			want: (&Config{}).ReportFilter(),
+			wantForecast: &types.Expression{
+				And: []types.Expression{accountFilter, *(&Config{}).ReportFilter()},
+			},
+		},
+		{
+			name: "GetCostAndUsageInput.Filter applies to the text report and forecasts",
+			cfg:  &Config{GetCostAndUsageInput: &costexplorer.GetCostAndUsageInput{Filter: filter}},
+			want: filter,
+			wantForecast: &types.Expression{
+				And: []types.Expression{accountFilter, *filter},
+			},
+		},
+		{
+			name: "Filter takes precedence",
+			cfg: &Config{
+				Filter:               filter,
+				GetCostAndUsageInput: &costexplorer.GetCostAndUsageInput{Filter: &types.Expression{}},
+			},
+			want: filter,
+			wantForecast: &types.Expression{
+				And: []types.Expression{accountFilter, *filter},
+			},
+		},
+		{
+			name: "Gross excludes credits and refunds from all queries",
+			cfg:  &Config{Filter: filter, Gross: true},
+			want: &types.Expression{
+				And: []types.Expression{*filter, noCredits},
+			},
+			wantForecast: &types.Expression{
+				And: []types.Expression{accountFilter, {And: []types.Expression{*filter, noCredits}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := NewCostOfTwoDaysAgo(tt.cfg, nil, now).getCostAndUsageInput().Filter
+			graph := NewCostGraphRenderer(tt.cfg, nil, now).getCostAndUsageInput().Filter
+			forecast := NewForecastsOfCurrentMonth(tt.cfg, nil, now).getCostForecastInput(Group{Id: "123", Filter: &accountFilter}).Filter
+			if !reflect.DeepEqual(text, tt.want) {
+				t.Errorf("text filter got = %v, want %v", text, tt.want)
+			}
+			if !reflect.DeepEqual(graph, tt.want) {
+				t.Errorf("graph filter got = %v, want %v", graph, tt.want)
+			}
+			if !reflect.DeepEqual(forecast, tt.wantForecast) {
+				t.Errorf("forecast filter got = %v, want %v", forecast, tt.wantForecast)
+			}
+		})
+	}
+}
+
+func Test_groupLabel(t *testing.T) {
+	linkedAccounts := map[string]string{"123": "foo"}
+	account := types.GroupDefinition{Type: types.GroupDefinitionTypeDimension, Key: aws.String(LinkedAccount)}
+	tag := types.GroupDefinition{Type: types.GroupDefinitionTypeTag, Key: aws.String("team")}
+	costCategory := types.GroupDefinition{Type: types.GroupDefinitionTypeCostCategory, Key: aws.String("Product")}
+	tests := []struct {
+		name string
+		def  types.GroupDefinition
+		key  string
+		want string
+	}{
+		{name: "account", def: account, key: "123", want: "foo"},
+		{name: "unknown account", def: account, key: "456", want: "456"},
+		{name: "tag", def: tag, key: "team$platform", want: "platform"},
+		{name: "untagged", def: tag, key: "team$", want: UntaggedLabel},
+		{name: "cost category", def: costCategory, key: "Product$Search", want: "Search"},
+		{name: "uncategorized", def: costCategory, key: "Product$", want: UncategorizedLabel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupLabel(tt.def, tt.key, linkedAccounts); got != tt.want {
+				t.Errorf("groupLabel() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_chartSeries(t *testing.T) {
+	day1 := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2022, 11, 2, 0, 0, 0, 0, time.UTC)
+	dailyCosts := []DailyCosts{
+		{Date: &day1, Costs: []Cost{
+			{ServiceName: "EC2", Amount: 10},
+			{ServiceName: "S3", Amount: 3},
+			{ServiceName: "Lambda", Amount: 1},
+		}},
+		{Date: &day2, Costs: []Cost{
+			{ServiceName: "EC2", Amount: 10},
+			{ServiceName: "RDS", Amount: 5},
+		}},
+	}
+	tests := []struct {
+		name         string
+		limit        int
+		wantNames    []string
+		wantSeriesOf map[string]string
+	}{
+		{
+			name:         "no limit",
+			limit:        0,
+			wantNames:    []string{"EC2", "Lambda", "RDS", "S3"},
+			wantSeriesOf: map[string]string{"EC2": "EC2", "Lambda": "Lambda", "RDS": "RDS", "S3": "S3"},
+		},
+		{
+			name:         "top 2",
+			limit:        2,
+			wantNames:    []string{"EC2", "RDS", OthersLabel},
+			wantSeriesOf: map[string]string{"EC2": "EC2", "Lambda": OthersLabel, "RDS": "RDS", "S3": OthersLabel},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, seriesOf := chartSeries(dailyCosts, serviceSeries, tt.limit)
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("chartSeries() names = %v, want %v", names, tt.wantNames)
+			}
+			if !reflect.DeepEqual(seriesOf, tt.wantSeriesOf) {
+				t.Errorf("chartSeries() seriesOf = %v, want %v", seriesOf, tt.wantSeriesOf)
+			}
+		})
+	}
+}
+
+func Test_renderCharts(t *testing.T) {
+	dailyCosts := []DailyCosts{}
+	serviceDailyCosts := []DailyCosts{}
+	regionDailyCosts := []DailyCosts{}
+	for i := 0; i < 30; i++ {
+		date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: []Cost{
+			{AccountName: "account_1", Amount: float64(i)},
+			{AccountName: "account_2", Amount: 2},
+		}})
+		serviceDailyCosts = append(serviceDailyCosts, DailyCosts{Date: &date, Costs: []Cost{
+			{ServiceName: "EC2", Amount: float64(i)},
+			{ServiceName: "S3", Amount: 1},
+		}})
+		regionDailyCosts = append(regionDailyCosts, DailyCosts{Date: &date, Costs: []Cost{
+			{Region: "us-east-1", Amount: float64(i)},
+			{Region: "eu-west-1", Amount: 1},
+		}})
+	}
+	report := &Report{
+		DailyCosts:        dailyCosts,
+		ServiceDailyCosts: serviceDailyCosts,
+		RegionDailyCosts:  regionDailyCosts,
+		Metric:            UnblendedCost,
+		Month:             time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+	}
+	period := &types.DateInterval{
+		Start: aws.String("2022-11-01"),
+		End:   aws.String("2022-11-30"),
+	}
+	cfg := &Config{
+		Charts: []string{ChartAccount, ChartService, ChartCumulative, ChartAccountLine, ChartHeatmap, ChartRegion},
+		ChartImages: map[string]ChartImage{
+			ChartTargetFile: {Format: ChartFormatSVG},
+		},
+	}
+	tests := []struct {
+		target   string
+		filename string
+		prefix   string
+	}{
+		{ChartTargetSlack, "daily_costs.png", "\x89PNG"},
+		{ChartTargetFile, "daily_costs.svg", "<?xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			charts, err := renderCharts(cfg, defaultMessages(), defaultCurrency(), period, report, tt.target)
+			if err != nil {
+				t.Fatalf("renderCharts() error = %v", err)
+			}
+			if len(charts) != 6 {
+				t.Fatalf("renderCharts() got %d charts, want 6", len(charts))
+			}
+			if charts[0].Filename != tt.filename {
+				t.Errorf("renderCharts() filename = %v, want %v", charts[0].Filename, tt.filename)
+			}
+			if want := "アカウント別の日次料金(2022-11-01〜2022-11-29)"; charts[0].Comment != want {
+				t.Errorf("renderCharts() comment = %v, want %v", charts[0].Comment, want)
+			}
+			for _, chart := range charts {
+				if !bytes.HasPrefix(chart.Buffer.Bytes(), []byte(tt.prefix)) {
+					t.Errorf("chart %s does not start with %q", chart.Name, tt.prefix)
+				}
 			}
 		})
 	}
 }
+
+func Test_renderChartsWithoutHeatmapCosts(t *testing.T) {
+	date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	report := &Report{
+		ServiceDailyCosts: []DailyCosts{{Date: &date, Costs: []Cost{{ServiceName: "EC2", Amount: 1}}}},
+		Metric:            UnblendedCost,
+	}
+	period := &types.DateInterval{Start: aws.String("2022-11-01"), End: aws.String("2022-11-02")}
+	cfg := &Config{Charts: []string{ChartHeatmap, ChartService}}
+	charts, err := renderCharts(cfg, defaultMessages(), defaultCurrency(), period, report, ChartTargetSlack)
+	if err != nil {
+		t.Fatalf("renderCharts() error = %v", err)
+	}
+	if len(charts) != 1 || charts[0].Name != ChartService {
+		t.Errorf("renderCharts() got %v, want only the service chart", charts)
+	}
+}
+
+func TestChartImage_newCanvas(t *testing.T) {
+	tests := []struct {
+		image   ChartImage
+		prefix  string
+		wantErr bool
+	}{
+		{ChartImage{}, "\x89PNG", false},
+		{ChartImage{Format: ChartFormatPNG, Width: 500, Height: 200, DPI: 144}, "\x89PNG", false},
+		{ChartImage{Format: ChartFormatSVG}, "<?xml", false},
+		{ChartImage{Format: ChartFormatPDF}, "%PDF", false},
+		{ChartImage{Format: "gif"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image.Format, func(t *testing.T) {
+			c, err := tt.image.newCanvas()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newCanvas() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			buf := new(bytes.Buffer)
+			if _, err := c.WriteTo(buf); err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if !bytes.HasPrefix(buf.Bytes(), []byte(tt.prefix)) {
+				t.Errorf("newCanvas() output does not start with %q", tt.prefix)
+			}
+		})
+	}
+}
+
+func Test_seriesColors(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	colors := []color.Color{red, blue}
+	ids := map[string]string{"a": "123", "b": "456"}
+	configured := map[string]color.Color{"456": green}
+
+	got := seriesColors([]string{"a", "b", "c", OthersLabel}, ids, colors, configured)
+	if got["b"] != green {
+		t.Errorf("seriesColors() b = %v, want configured color %v", got["b"], green)
+	}
+	if got[OthersLabel] != OthersColor {
+		t.Errorf("seriesColors() Others = %v, want %v", got[OthersLabel], OthersColor)
+	}
+
+	// The color of a series must not depend on the other series.
+	again := seriesColors([]string{"x", "a", "c"}, ids, colors, configured)
+	for _, name := range []string{"a", "c"} {
+		if got[name] != again[name] {
+			t.Errorf("seriesColors() %s = %v after adding a series, want %v", name, again[name], got[name])
+		}
+	}
+}
+
+func Test_drawStackedBarChartWithMoreSeriesThanColors(t *testing.T) {
+	dailyCosts := []DailyCosts{}
+	for i := 0; i < 3; i++ {
+		date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		costs := []Cost{}
+		for j := 0; j < 30; j++ {
+			costs = append(costs, Cost{AccountName: fmt.Sprintf("account_%02d", j), Amount: float64(j)})
+		}
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: costs})
+	}
+	opts := chartOptions{
+		Colors:     []color.Color{color.Black},
+		Currency:   defaultCurrency(),
+		SeriesName: accountSeries,
+	}
+	if _, err := drawStackedBarChart(opts, dailyCosts); err != nil {
+		t.Errorf("drawStackedBarChart() error = %v", err)
+	}
+}
+
+func Test_transformToForecasts(t *testing.T) {
+	results := []types.ForecastResult{
+		{
+			TimePeriod:                   &types.DateInterval{Start: aws.String("2022-11-24"), End: aws.String("2022-11-25")},
+			MeanValue:                    aws.String("10.5"),
+			PredictionIntervalLowerBound: aws.String("8"),
+			PredictionIntervalUpperBound: aws.String("13"),
+		},
+		{
+			TimePeriod: &types.DateInterval{Start: aws.String("2022-11-25"), End: aws.String("2022-11-26")},
+			MeanValue:  aws.String("11"),
+		},
+	}
+	got, err := transformToForecasts(results)
+	if err != nil {
+		t.Fatalf("transformToForecasts() error = %v", err)
+	}
+	d1 := time.Date(2022, 11, 24, 0, 0, 0, 0, time.UTC)
+	d2 := time.Date(2022, 11, 25, 0, 0, 0, 0, time.UTC)
+	want := []DailyForecast{
+		{Date: &d1, Mean: 10.5, Lower: 8, Upper: 13},
+		{Date: &d2, Mean: 11},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transformToForecasts() got = %v, want %v", got, want)
+	}
+}
+
+func Test_drawStackedBarChartWithForecasts(t *testing.T) {
+	dailyCosts := []DailyCosts{}
+	for i := 0; i < 23; i++ {
+		date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: []Cost{
+			{AccountName: "account_1", Amount: 3},
+			{AccountName: "account_2", Amount: 2},
+		}})
+	}
+	forecasts := []DailyForecast{}
+	for i := 23; i < 30; i++ {
+		date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		forecasts = append(forecasts, DailyForecast{Date: &date, Mean: 5, Lower: 4, Upper: 7})
+	}
+	colors, _ := generateColors(nil)
+	opts := chartOptions{
+		Colors:     colors,
+		Currency:   defaultCurrency(),
+		SeriesName: accountSeries,
+		Forecasts:  forecasts,
+	}
+	buf, err := drawStackedBarChart(opts, dailyCosts)
+	if err != nil {
+		t.Fatalf("drawStackedBarChart() error = %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("\x89PNG")) {
+		t.Errorf("drawStackedBarChart() did not return a PNG image")
+	}
+}
+
+func Test_forecastGap(t *testing.T) {
+	day := func(d int) *time.Time {
+		date := time.Date(2022, 11, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	dailyCosts := []DailyCosts{{Date: day(21)}, {Date: day(22)}}
+	tests := []struct {
+		name      string
+		forecasts []DailyForecast
+		want      []time.Time
+	}{
+		{"no forecasts", nil, nil},
+		{"following the last day", []DailyForecast{{Date: day(23)}}, []time.Time{}},
+		{"after yesterday", []DailyForecast{{Date: day(24)}, {Date: day(25)}}, []time.Time{*day(23)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forecastGap(dailyCosts, tt.forecasts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forecastGap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cumulativeCosts(t *testing.T) {
+	dailyCosts := []DailyCosts{}
+	for _, d := range []time.Time{
+		time.Date(2022, 10, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 11, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 11, 4, 0, 0, 0, 0, time.UTC),
+		time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		date := d
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: []Cost{
+			{AccountName: "a", Amount: 1},
+			{AccountName: "b", Amount: 2},
+		}})
+	}
+	got := cumulativeCosts(dailyCosts, time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC))
+	want := plotter.XYs{{X: 1, Y: 3}, {X: 2, Y: 6}, {X: 4, Y: 9}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cumulativeCosts() got = %v, want %v", got, want)
+	}
+}
+
+func Test_newCalendar(t *testing.T) {
+	dailyCosts := []DailyCosts{}
+	// 2022-11-02 is a Wednesday.
+	for i := 0; i < 7; i++ {
+		date := time.Date(2022, 11, 2, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: []Cost{
+			{AccountId: "123", AccountName: "a", Amount: float64(i)},
+			{AccountId: "456", AccountName: "b", Amount: 10},
+		}})
+	}
+
+	got := newCalendar(dailyCosts, "")
+	wantWeeks := []time.Time{
+		time.Date(2022, 10, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 11, 7, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(got.Weeks, wantWeeks) {
+		t.Fatalf("newCalendar() weeks = %v, want %v", got.Weeks, wantWeeks)
+	}
+	// Monday and Tuesday of the first week have no costs.
+	if !math.IsNaN(got.Values[0][0]) || !math.IsNaN(got.Values[0][1]) {
+		t.Errorf("newCalendar() days before the first day = %v, want NaN", got.Values[0])
+	}
+	if got.Values[0][2] != 10 || got.Values[1][1] != 16 {
+		t.Errorf("newCalendar() values = %v", got.Values)
+	}
+	// Rows are drawn from Sunday at the bottom to Monday at the top.
+	if got.Z(1, 6) != 15 || got.Z(0, 0) != 14 {
+		t.Errorf("newCalendar() Z does not put Monday at the top")
+	}
+
+	byAccount := newCalendar(dailyCosts, "123")
+	if byAccount.Values[1][1] != 6 {
+		t.Errorf("newCalendar() value of account = %v, want 6", byAccount.Values[1][1])
+	}
+}
+
+func Test_loadAnnotationsFile(t *testing.T) {
+	dir := t.TempDir()
+	want := []Annotation{
+		{Date: "2022-11-01", Label: "v1.2.0"},
+		{Date: "2022-11-10", Label: "batch, nightly"},
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []Annotation
+		wantErr bool
+	}{
+		{"events.json", `[{"date": "2022-11-01", "label": "v1.2.0"}, {"date": "2022-11-10", "label": "batch, nightly"}]`, want, false},
+		{"events.csv", "date,label\n2022-11-01,v1.2.0\n2022-11-10,\"batch, nightly\"\n", want, false},
+		{"invalid.csv", "2022/11/01,v1.2.0\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := dir + "/" + tt.name
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadAnnotationsFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadAnnotationsFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadAnnotationsFile() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_anomalyAnnotations(t *testing.T) {
+	anomalies := []types.Anomaly{
+		{AnomalyStartDate: aws.String("2022-11-03T00:00:00Z"), RootCauses: []types.RootCause{{Service: aws.String("Amazon EC2")}}},
+		{AnomalyStartDate: aws.String("2022-11-05"), DimensionValue: aws.String("Amazon S3")},
+		{AnomalyStartDate: nil},
+	}
+	got := anomalyAnnotations(anomalies)
+	want := []Annotation{
+		{Date: "2022-11-03", Label: "Anomaly: Amazon EC2"},
+		{Date: "2022-11-05", Label: "Anomaly: Amazon S3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("anomalyAnnotations() got = %v, want %v", got, want)
+	}
+}
+
+func Test_annotationMarkers(t *testing.T) {
+	annotations := []Annotation{
+		{Date: "2022-11-02", Label: "deploy"},
+		{Date: "2022-11-02", Label: "Anomaly: Amazon EC2"},
+		{Date: "2022-10-01", Label: "outside of the chart"},
+	}
+	positions := map[string]int{"2022-11-01": 0, "2022-11-02": 1}
+	markers, err := annotationMarkers(annotations, positions, 10)
+	if err != nil {
+		t.Fatalf("annotationMarkers() error = %v", err)
+	}
+	if len(markers) != 2 {
+		t.Fatalf("annotationMarkers() got %d markers, want a line and a label", len(markers))
+	}
+	label := markers[1].(*plotter.Labels)
+	if !reflect.DeepEqual(label.Labels, []string{"deploy, Anomaly: Amazon EC2"}) || label.XYs[0].X != 1 {
+		t.Errorf("annotationMarkers() label = %v at %v", label.Labels, label.XYs)
+	}
+}
+
+func TestCostGraphRenderer_transformToCosts(t *testing.T) {
+	results := []types.ResultByTime{
+		{
+			TimePeriod: &types.DateInterval{Start: aws.String("2022-11-01"), End: aws.String("2022-11-02")},
+			Groups: []types.Group{
+				{Keys: []string{"123"}, Metrics: map[string]types.MetricValue{UnblendedCost: {Amount: aws.String("1.5")}}},
+			},
+		},
+		{
+			TimePeriod: &types.DateInterval{Start: aws.String("2022-11-02"), End: aws.String("2022-11-03")},
+			Estimated:  true,
+			Groups: []types.Group{
+				{Keys: []string{"123"}, Metrics: map[string]types.MetricValue{UnblendedCost: {Amount: aws.String("2")}}},
+			},
+		},
+	}
+	groupBy := types.GroupDefinition{Type: types.GroupDefinitionTypeDimension, Key: aws.String(LinkedAccount)}
+	attributes := []types.DimensionValuesWithAttributes{{Value: aws.String("123"), Attributes: map[string]string{"description": "account_1"}}}
+	got, err := NewCostGraphRenderer(&Config{}, nil, time.Now()).transformToCosts(groupBy, attributes, results)
+	if err != nil {
+		t.Fatalf("transformToCosts() error = %v", err)
+	}
+	date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	next := date.AddDate(0, 0, 1)
+	want := []DailyCosts{
+		{Date: &date, Costs: []Cost{{AccountId: "123", AccountName: "account_1", Amount: 1.5}}},
+		{Date: &next, Costs: []Cost{{AccountId: "123", AccountName: "account_1", Amount: 2, Estimated: true}}, Estimated: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transformToCosts() got = %v, want %v", got, want)
+	}
+
+	byRegion := types.GroupDefinition{Type: types.GroupDefinitionTypeDimension, Key: aws.String(string(types.DimensionRegion))}
+	results[0].Groups[0].Keys = []string{"us-east-1"}
+	got, err = NewCostGraphRenderer(&Config{}, nil, time.Now()).transformToCosts(byRegion, nil, results[:1])
+	if err != nil {
+		t.Fatalf("transformToCosts() error = %v", err)
+	}
+	want = []DailyCosts{{Date: &date, Costs: []Cost{{Region: "us-east-1", Amount: 1.5}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transformToCosts() by region got = %v, want %v", got, want)
+	}
+}
+
+func Test_aggregateCosts(t *testing.T) {
+	dailyCosts := []DailyCosts{}
+	// From Saturday 2022-11-05 to Tuesday 2022-11-08.
+	for i := 0; i < 4; i++ {
+		date := time.Date(2022, 11, 5, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: []Cost{
+			{AccountName: "a", Amount: 1},
+			{AccountName: "b", Amount: 2},
+		}})
+	}
+	if got := aggregateCosts(dailyCosts, types.GranularityDaily); !reflect.DeepEqual(got, dailyCosts) {
+		t.Errorf("aggregateCosts() daily got = %v, want %v", got, dailyCosts)
+	}
+
+	got := aggregateCosts(dailyCosts, GranularityWeekly)
+	w1 := time.Date(2022, 10, 31, 0, 0, 0, 0, time.UTC)
+	w2 := time.Date(2022, 11, 7, 0, 0, 0, 0, time.UTC)
+	want := []DailyCosts{
+		{Date: &w1, Costs: []Cost{{AccountName: "a", Amount: 2}, {AccountName: "b", Amount: 4}}},
+		{Date: &w2, Costs: []Cost{{AccountName: "a", Amount: 2}, {AccountName: "b", Amount: 4}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("aggregateCosts() weekly got = %v, want %v", got, want)
+	}
+	if dailyCosts[0].Costs[0].Amount != 1 {
+		t.Errorf("aggregateCosts() modified the daily costs")
+	}
+}
+
+func Test_periodLabels(t *testing.T) {
+	dates := func(start time.Time, n int, next func(time.Time) time.Time) []DailyCosts {
+		dailyCosts := []DailyCosts{}
+		for d := start; len(dailyCosts) < n; d = next(d) {
+			date := d
+			dailyCosts = append(dailyCosts, DailyCosts{Date: &date})
+		}
+		return dailyCosts
+	}
+	tests := []struct {
+		name        string
+		dailyCosts  []DailyCosts
+		granularity types.Granularity
+		want        []string
+	}{
+		{
+			name:        "daily",
+			dailyCosts:  dates(time.Date(2022, 10, 30, 0, 0, 0, 0, time.UTC), 4, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }),
+			granularity: types.GranularityDaily,
+			want:        []string{"", "", "2022-11-01", "2022-11-02"},
+		},
+		{
+			name:        "weekly",
+			dailyCosts:  dates(time.Date(2022, 10, 24, 0, 0, 0, 0, time.UTC), 4, func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }),
+			granularity: GranularityWeekly,
+			want:        []string{"", "", "2022-11-07", "2022-11-14"},
+		},
+		{
+			name:        "monthly",
+			dailyCosts:  dates(time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC), 3, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }),
+			granularity: types.GranularityMonthly,
+			want:        []string{"2022-09", "2022-10", "2022-11"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := periodLabels(tt.dailyCosts, tt.granularity); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("periodLabels() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateGranularity(t *testing.T) {
+	tests := []struct {
+		granularity types.Granularity
+		charts      []string
+		wantErr     bool
+	}{
+		{types.GranularityDaily, []string{ChartAccount, ChartHeatmap}, false},
+		{GranularityWeekly, []string{ChartAccount, ChartCumulative}, false},
+		{types.GranularityMonthly, []string{ChartAccount, ChartService}, false},
+		{types.GranularityMonthly, []string{ChartHeatmap}, true},
+		{types.GranularityHourly, []string{ChartAccount}, true},
+	}
+	for _, tt := range tests {
+		if err := validateGranularity(tt.granularity, tt.charts); (err != nil) != tt.wantErr {
+			t.Errorf("validateGranularity(%v, %v) error = %v, wantErr %v", tt.granularity, tt.charts, err, tt.wantErr)
+		}
+	}
+}
+
+func Test_serviceBreakdown(t *testing.T) {
+	costs := []Cost{
+		{AccountName: "account_1", ServiceName: "service_a", Amount: 1},
+		{AccountName: "account_1", ServiceName: "service_b", Amount: 3},
+		{AccountName: "account_2", ServiceName: "service_a", Amount: 6},
+		{AccountName: "account_2", ServiceName: "service_b", Amount: 2},
+		{AccountName: "account_2", ServiceName: "service_c", Amount: 2},
+		{AccountName: "account_3", ServiceName: "service_a", Amount: 1},
+	}
+	got := serviceBreakdown(costs, 2, 2)
+	want := []AccountBreakdown{
+		{AccountName: "account_2", Amount: 10, Services: []ServiceShare{
+			{ServiceName: "service_a", Amount: 6, Share: 60},
+			{ServiceName: "service_b", Amount: 2, Share: 20},
+		}},
+		{AccountName: "account_1", Amount: 4, Services: []ServiceShare{
+			{ServiceName: "service_b", Amount: 3, Share: 75},
+			{ServiceName: "service_a", Amount: 1, Share: 25},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceBreakdown() got = %v, want %v", got, want)
+	}
+
+	data := TemplateData{ServiceBreakdown: want}
+	table := data.ServiceBreakdownTable()
+	for _, row := range []string{"account_2  service_a       6.00  60.0%", "           service_b       2.00  20.0%"} {
+		if !strings.Contains(table, row) {
+			t.Errorf("ServiceBreakdownTable() = %q, want a row %q", table, row)
+		}
+	}
+
+	// Shares of different widths are right-aligned like the costs.
+	data = TemplateData{ServiceBreakdown: []AccountBreakdown{{AccountName: "account_1", Amount: 100, Services: []ServiceShare{
+		{ServiceName: "service_a", Amount: 95, Share: 95},
+		{ServiceName: "service_b", Amount: 5, Share: 5},
+	}}}}
+	table = data.ServiceBreakdownTable()
+	for _, row := range []string{"account_1  service_a      95.00  95.0%", "           service_b       5.00   5.0%"} {
+		if !strings.Contains(table, row) {
+			t.Errorf("ServiceBreakdownTable() = %q, want a row %q", table, row)
+		}
+	}
+}
+
+func Test_toDayAmounts(t *testing.T) {
+	group := func(amount string, keys ...string) types.Group {
+		return types.Group{Keys: keys, Metrics: map[string]types.MetricValue{UnblendedCost: {Amount: aws.String(amount)}}}
+	}
+	results := []types.ResultByTime{
+		{
+			TimePeriod: &types.DateInterval{Start: aws.String("2022-11-22"), End: aws.String("2022-11-23")},
+			Groups:     []types.Group{group("1", "BoxUsage:m5.large", "RunInstances"), group("2", "DataTransfer-Out-Bytes", "RunInstances")},
+		},
+		{
+			TimePeriod: &types.DateInterval{Start: aws.String("2022-11-23"), End: aws.String("2022-11-24")},
+			Groups:     []types.Group{group("1.5", "BoxUsage:m5.large", "RunInstances"), group("7", "DataTransfer-Out-Bytes", "RunInstances")},
+		},
+	}
+	got, err := toDayAmounts(results, UnblendedCost, "2022-11-22")
+	if err != nil {
+		t.Fatalf("toDayAmounts() error = %v", err)
+	}
+	want := dayAmounts{
+		{"BoxUsage:m5.large", "RunInstances"}:      {1, 1.5},
+		{"DataTransfer-Out-Bytes", "RunInstances"}: {2, 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("toDayAmounts() got = %v, want %v", got, want)
+	}
+
+	if reportDayEstimated(results, "2022-11-22") {
+		t.Errorf("reportDayEstimated() = true, want false")
+	}
+	results[0].Estimated = true
+	if reportDayEstimated(results, "2022-11-22") {
+		t.Errorf("reportDayEstimated() = true for an estimated previous day, want false")
+	}
+	results[1].Estimated = true
+	if !reportDayEstimated(results, "2022-11-22") {
+		t.Errorf("reportDayEstimated() = false, want true")
+	}
+}
+
+func Test_topChanges(t *testing.T) {
+	amounts := dayAmounts{
+		{"EC2"}:        {10, 12},
+		{"S3"}:         {5, 1},
+		{"Lambda"}:     {1, 1},
+		{"CloudWatch"}: {0, 2},
+	}
+	got := topChanges(amounts, 2)
+	want := [][2]string{{"S3"}, {"CloudWatch"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topChanges() got = %v, want %v", got, want)
+	}
+}
+
+func TestTemplateData_DrillDownTable(t *testing.T) {
+	data := TemplateData{DrillDowns: []DrillDown{
+		{ServiceName: "EC2", Amount: 12, Previous: 10, Items: []UsageCost{
+			{UsageType: "DataTransfer-Out-Bytes", Operation: "RunInstances", Amount: 7, Previous: 2},
+			{UsageType: "BoxUsage:m5.large", Operation: "RunInstances", Amount: 1, Previous: 4},
+		}},
+	}}
+	want := `  SERVICE        USAGE TYPE         OPERATION    COST(USD)  CHANGE  
+  EC2                                                12.00   +2.00  
+           DataTransfer-Out-Bytes  RunInstances       7.00   +5.00  
+           BoxUsage:m5.large       RunInstances       1.00   -3.00  
+`
+	if got := data.DrillDownTable(); got != want {
+		t.Errorf("DrillDownTable() got = %q, want %q", got, want)
+	}
+}
+
+func TestCostOfTwoDaysAgo_transformToDimensionCosts(t *testing.T) {
+	results := []types.ResultByTime{
+		{
+			Groups: []types.Group{
+				{Keys: []string{"a"}, Metrics: map[string]types.MetricValue{UnblendedCost: {Amount: aws.String("12.5")}}},
+				{Keys: []string{"b"}, Metrics: map[string]types.MetricValue{UnblendedCost: {Amount: aws.String("-1")}}},
+			},
+		},
+	}
+	tests := []struct {
+		dimension types.Dimension
+		want      []Cost
+	}{
+		{types.DimensionRegion, []Cost{{Region: "a", Amount: 12.5}, {Region: "b", Amount: -1}}},
+		{types.DimensionRecordType, []Cost{{RecordType: "a", Amount: 12.5}, {RecordType: "b", Amount: -1}}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.dimension), func(t *testing.T) {
+			got, err := NewCostOfTwoDaysAgo(&Config{}, nil, time.Now()).transformToDimensionCosts(tt.dimension, results)
+			if err != nil {
+				t.Fatalf("transformToDimensionCosts() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transformToDimensionCosts() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateData_RegionTable(t *testing.T) {
+	data := TemplateData{CostsByRegion: costsByRegion([]Cost{
+		{Region: "ap-northeast-1", Amount: 1},
+		{Region: "us-east-1", Amount: 10},
+		{Region: "eu-west-1", Amount: 0},
+		{Region: "ap-northeast-1", Amount: 2},
+	})}
+	want := []Cost{{Region: "us-east-1", Amount: 10}, {Region: "ap-northeast-1", Amount: 3}}
+	if !reflect.DeepEqual(data.CostsByRegion, want) {
+		t.Fatalf("costsByRegion() got = %v, want %v", data.CostsByRegion, want)
+	}
+	got := data.RegionTable()
+	for _, s := range []string{"REGION", "us-east-1", "10.00", "ap-northeast-1", "3.00"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("RegionTable() = %q, does not contain %q", got, s)
+		}
+	}
+	if strings.Index(got, "us-east-1") > strings.Index(got, "ap-northeast-1") {
+		t.Errorf("RegionTable() = %q, want us-east-1 first", got)
+	}
+}
+
+func Test_savingsPlansCommitment(t *testing.T) {
+	utilization := &types.SavingsPlansUtilizationAggregates{
+		Utilization: &types.SavingsPlansUtilization{
+			UtilizationPercentage: aws.String("90"),
+			UnusedCommitment:      aws.String("10"),
+		},
+	}
+	coverages := []types.SavingsPlansCoverage{
+		{Coverage: &types.SavingsPlansCoverageData{OnDemandCost: aws.String("20"), SpendCoveredBySavingsPlans: aws.String("60"), TotalCost: aws.String("80")}},
+		{Coverage: &types.SavingsPlansCoverageData{OnDemandCost: aws.String("10"), SpendCoveredBySavingsPlans: aws.String("10"), TotalCost: aws.String("20")}},
+	}
+	got, err := savingsPlansCommitment(utilization, coverages)
+	if err != nil {
+		t.Fatalf("savingsPlansCommitment() error = %v", err)
+	}
+	want := Commitment{Name: SavingsPlansLabel, Utilization: 90, Coverage: 70, OnDemandCost: 30, UnusedCost: 10}
+	if got != want {
+		t.Errorf("savingsPlansCommitment() got = %v, want %v", got, want)
+	}
+}
+
+func Test_reservationCommitment(t *testing.T) {
+	tests := []struct {
+		name        string
+		utilization *types.ReservationAggregates
+		coverage    *types.Coverage
+		want        Commitment
+	}{
+		{
+			name: "reservations",
+			utilization: &types.ReservationAggregates{
+				UtilizationPercentage: aws.String("75.5"),
+				RICostForUnusedHours:  aws.String("4.2"),
+			},
+			coverage: &types.Coverage{
+				CoverageHours: &types.CoverageHours{CoverageHoursPercentage: aws.String("40")},
+				CoverageCost:  &types.CoverageCost{OnDemandCost: aws.String("12")},
+			},
+			want: Commitment{Name: ReservedInstancesLabel, Utilization: 75.5, Coverage: 40, OnDemandCost: 12, UnusedCost: 4.2},
+		},
+		{
+			name: "missing totals",
+			want: Commitment{Name: ReservedInstancesLabel},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reservationCommitment(tt.utilization, tt.coverage)
+			if err != nil {
+				t.Fatalf("reservationCommitment() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("reservationCommitment() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateData_CommitmentTable(t *testing.T) {
+	data := TemplateData{Commitments: []Commitment{
+		{Name: SavingsPlansLabel, Utilization: 98.4, Coverage: 70, OnDemandCost: 30, UnusedCost: 1.5},
+	}}
+	got := data.CommitmentTable()
+	for _, s := range []string{"UTILIZATION", "Savings Plans", "98.4%", "70.0%", "30.00", "1.50"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("CommitmentTable() = %q, does not contain %q", got, s)
+		}
+	}
+}
+
+func Test_rightsizingRecommendation(t *testing.T) {
+	ec2 := func(instanceType string) *types.ResourceDetails {
+		return &types.ResourceDetails{EC2ResourceDetails: &types.EC2ResourceDetails{InstanceType: aws.String(instanceType)}}
+	}
+	tests := []struct {
+		name string
+		rec  types.RightsizingRecommendation
+		want Recommendation
+	}{
+		{
+			name: "modify",
+			rec: types.RightsizingRecommendation{
+				AccountId:       aws.String("111111111111"),
+				RightsizingType: types.RightsizingTypeModify,
+				CurrentInstance: &types.CurrentInstance{ResourceId: aws.String("i-1"), ResourceDetails: ec2("m5.2xlarge")},
+				ModifyRecommendationDetail: &types.ModifyRecommendationDetail{TargetInstances: []types.TargetInstance{
+					{ResourceDetails: ec2("m5.large"), EstimatedMonthlySavings: aws.String("150")},
+					{ResourceDetails: ec2("m5.xlarge"), EstimatedMonthlySavings: aws.String("100"), DefaultTargetInstance: true},
+				}},
+			},
+			want: Recommendation{Type: RightsizingLabel, AccountId: "111111111111", Description: "Modify i-1 (m5.2xlarge) to m5.xlarge", EstimatedMonthlySavings: 100},
+		},
+		{
+			name: "terminate",
+			rec: types.RightsizingRecommendation{
+				AccountId:                     aws.String("222222222222"),
+				RightsizingType:               types.RightsizingTypeTerminate,
+				CurrentInstance:               &types.CurrentInstance{ResourceId: aws.String("i-2"), ResourceDetails: ec2("t3.micro")},
+				TerminateRecommendationDetail: &types.TerminateRecommendationDetail{EstimatedMonthlySavings: aws.String("7.5")},
+			},
+			want: Recommendation{Type: RightsizingLabel, AccountId: "222222222222", Description: "Terminate i-2 (t3.micro)", EstimatedMonthlySavings: 7.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rightsizingRecommendation(tt.rec)
+			if err != nil {
+				t.Fatalf("rightsizingRecommendation() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rightsizingRecommendation() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_savingsPlansRecommendations(t *testing.T) {
+	got, err := savingsPlansRecommendations(types.SavingsPlansPurchaseRecommendation{
+		SavingsPlansType: types.SupportedSavingsPlansTypeComputeSp,
+		TermInYears:      types.TermInYearsOneYear,
+		PaymentOption:    types.PaymentOptionNoUpfront,
+		SavingsPlansPurchaseRecommendationDetails: []types.SavingsPlansPurchaseRecommendationDetail{
+			{AccountId: aws.String("111111111111"), HourlyCommitmentToPurchase: aws.String("1.5"), EstimatedMonthlySavingsAmount: aws.String("300")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("savingsPlansRecommendations() error = %v", err)
+	}
+	want := []Recommendation{
+		{Type: SavingsPlansLabel, AccountId: "111111111111", Description: "Purchase Compute Savings Plans (one year, no upfront)", HourlyCommitment: 1.5, EstimatedMonthlySavings: 300},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("savingsPlansRecommendations() got = %v, want %v", got, want)
+	}
+}
+
+func Test_topRecommendations(t *testing.T) {
+	recommendations := []Recommendation{
+		{Description: "a", EstimatedMonthlySavings: 10},
+		{Description: "b", EstimatedMonthlySavings: 0},
+		{Description: "c", EstimatedMonthlySavings: 30},
+		{Description: "d", EstimatedMonthlySavings: 20},
+	}
+	got := topRecommendations(recommendations, 2)
+	want := []Recommendation{
+		{Description: "c", EstimatedMonthlySavings: 30},
+		{Description: "d", EstimatedMonthlySavings: 20},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topRecommendations() got = %v, want %v", got, want)
+	}
+}
+
+func TestConfig_IsRecommendationDay(t *testing.T) {
+	monday := time.Date(2022, 11, 7, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		cfg  Config
+		now  time.Time
+		want bool
+	}{
+		{"disabled", Config{}, monday, false},
+		{"default weekday", Config{Recommendations: true}, monday, true},
+		{"other day", Config{Recommendations: true}, monday.AddDate(0, 0, 1), false},
+		{"configured weekday", Config{Recommendations: true, RecommendationWeekday: "friday"}, monday.AddDate(0, 0, 4), true},
+		{"unknown weekday", Config{Recommendations: true, RecommendationWeekday: "someday"}, monday, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.IsRecommendationDay(tt.now); got != tt.want {
+				t.Errorf("IsRecommendationDay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_recordTypeBreakdown(t *testing.T) {
+	got := recordTypeBreakdown([]Cost{
+		{RecordType: "Usage", Amount: 100},
+		{RecordType: "Credit", Amount: -30},
+		{RecordType: "Tax", Amount: 10},
+		{RecordType: "Refund", Amount: -5},
+		{RecordType: "SavingsPlanNegation", Amount: 0},
+	}, 65, false)
+	want := &RecordTypeBreakdown{
+		RecordTypes: []Cost{
+			{RecordType: "Usage", Amount: 100},
+			{RecordType: "Tax", Amount: 10},
+			{RecordType: "Refund", Amount: -5},
+			{RecordType: "Credit", Amount: -30},
+		},
+		Gross:    110,
+		Credits:  -35,
+		Net:      75,
+		Excluded: 10,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recordTypeBreakdown() got = %v, want %v", got, want)
+	}
+	// With Gross, the report total is before credits and refunds.
+	if got := recordTypeBreakdown(want.RecordTypes, 100, true); got.Excluded != 10 {
+		t.Errorf("recordTypeBreakdown() with gross Excluded = %v, want 10", got.Excluded)
+	}
+	if got := recordTypeBreakdown(want.RecordTypes, 75, false); got.Excluded != 0 {
+		t.Errorf("recordTypeBreakdown() Excluded = %v, want 0", got.Excluded)
+	}
+	if got := recordTypeBreakdown(nil, 0, false); got != nil {
+		t.Errorf("recordTypeBreakdown(nil) got = %v, want nil", got)
+	}
+
+	table := TemplateData{RecordTypes: want}.RecordTypeTable()
+	for _, s := range []string{"RECORD TYPE", "Credit", "-30.00", "クレジット・返金適用前", "110.00", "クレジット・返金適用後", "75.00", "合計に含まれない料金(税金など)", "10.00"} {
+		if !strings.Contains(table, s) {
+			t.Errorf("RecordTypeTable() = %q, does not contain %q", table, s)
+		}
+	}
+}
+
+func Test_estimatedCosts(t *testing.T) {
+	data, err := templateData(nil, []Cost{
+		{AccountName: "account_1", ServiceName: "EC2", Amount: 2, Estimated: true},
+		{AccountName: "account_2", ServiceName: "S3", Amount: 1},
+	}, nil, &types.DateInterval{Start: aws.String("2022-11-23"), End: aws.String("2022-11-24")})
+	if err != nil {
+		t.Fatalf("templateData() error = %v", err)
+	}
+	if !data.Estimated {
+		t.Errorf("templateData() Estimated = false, want true")
+	}
+	table := data.CostTable()
+	for _, s := range []string{"2.00*", "1.00"} {
+		if !strings.Contains(table, s) {
+			t.Errorf("CostTable() = %q, does not contain %q", table, s)
+		}
+	}
+	if strings.Contains(table, "1.00*") {
+		t.Errorf("CostTable() = %q, marks a finalized cost", table)
+	}
+
+	// The breakdowns of the same day mark the same amounts.
+	data.ServiceBreakdown = serviceBreakdown(data.Costs, 2, 1)
+	data.RecordTypes = recordTypeBreakdown([]Cost{{RecordType: "Usage", Amount: 3, Estimated: true}}, 3, false)
+	data.DrillDowns = []DrillDown{{ServiceName: "EC2", Amount: 2, Previous: 1, Items: []UsageCost{{UsageType: "BoxUsage", Operation: "RunInstances", Amount: 2, Previous: 1}}, Estimated: true}}
+	tables := []struct {
+		name  string
+		table string
+		want  []string
+	}{
+		{"ServiceBreakdownTable", data.ServiceBreakdownTable(), []string{"2.00*", "1.00 "}},
+		{"RecordTypeTable", data.RecordTypeTable(), []string{"Usage", "3.00*"}},
+		{"DrillDownTable", data.DrillDownTable(), []string{"EC2", "BoxUsage", "2.00*"}},
+	}
+	for _, tt := range tables {
+		for _, s := range tt.want {
+			if !strings.Contains(tt.table, s) {
+				t.Errorf("%s() = %q, does not contain %q", tt.name, tt.table, s)
+			}
+		}
+	}
+	if strings.Contains(tables[0].table, "1.00*") {
+		t.Errorf("ServiceBreakdownTable() = %q, marks a finalized cost", tables[0].table)
+	}
+
+	date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	next := date.AddDate(0, 0, 1)
+	dailyCosts := []DailyCosts{
+		{Date: &date, Costs: []Cost{{AccountName: "a", Amount: 1}}},
+		{Date: &next, Costs: []Cost{{AccountName: "a", Amount: 2}, {AccountName: "b", Amount: 3}}, Estimated: true},
+	}
+	bars, err := estimatedBars(dailyCosts, 3, vg.Points(10))
+	if err != nil {
+		t.Fatalf("estimatedBars() error = %v", err)
+	}
+	if want := (plotter.Values{0, 5, 0}); !reflect.DeepEqual(bars.Values, want) {
+		t.Errorf("estimatedBars() values = %v, want %v", bars.Values, want)
+	}
+	if bars, _ := estimatedBars(dailyCosts[:1], 1, vg.Points(10)); bars != nil {
+		t.Errorf("estimatedBars() = %v, want nil without estimated days", bars)
+	}
+}
+
+func TestCostHistory_DailyCosts(t *testing.T) {
+	history := &CostHistory{store: &fileHistoryStore{dir: t.TempDir()}}
+	input := func(start, end string) *costexplorer.GetCostAndUsageInput {
+		return &costexplorer.GetCostAndUsageInput{
+			Granularity: types.GranularityDaily,
+			Metrics:     []string{UnblendedCost},
+			TimePeriod:  &types.DateInterval{Start: aws.String(start), End: aws.String(end)},
+		}
+	}
+	var fetched []string
+	fetch := func(input *costexplorer.GetCostAndUsageInput) ([]DailyCosts, error) {
+		fetched = append(fetched, *input.TimePeriod.Start)
+		dailyCosts := []DailyCosts{}
+		start, _ := time.Parse("2006-01-02", *input.TimePeriod.Start)
+		end, _ := time.Parse("2006-01-02", *input.TimePeriod.End)
+		for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+			date := d
+			estimated := !d.Before(end.AddDate(0, 0, -1))
+			dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: []Cost{{AccountName: "foo", Amount: float64(d.Day())}}, Estimated: estimated})
+		}
+		return dailyCosts, nil
+	}
+
+	tests := []struct {
+		name        string
+		start       string
+		end         string
+		wantFetched []string
+		wantDays    int
+	}{
+		{"nothing stored", "2024-01-30", "2024-02-03", []string{"2024-01-30"}, 4},
+		// The last day was estimated, so it is fetched again.
+		{"stored until the estimated day", "2024-01-30", "2024-02-04", []string{"2024-02-02"}, 5},
+		{"all stored", "2024-01-31", "2024-02-03", nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched = nil
+			got, err := history.DailyCosts(input(tt.start, tt.end), fetch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fetched, tt.wantFetched) {
+				t.Errorf("fetched = %v, want %v", fetched, tt.wantFetched)
+			}
+			if len(got) != tt.wantDays {
+				t.Fatalf("days = %d, want %d", len(got), tt.wantDays)
+			}
+			for i, dc := range got {
+				if want := dc.Date.Day(); dc.Costs[0].Amount != float64(want) {
+					t.Errorf("got[%d] = %v, want %v", i, dc.Costs[0].Amount, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCostHistory_PreviousForecast(t *testing.T) {
+	store := &fileHistoryStore{dir: t.TempDir()}
+	history := &CostHistory{store: store, query: newReportQuery(&Config{})}
+	report := func(day string, forecasts map[string]float64) *Report {
+		return &Report{
+			Period:         &types.DateInterval{Start: aws.String(day), End: aws.String(day)},
+			Costs:          []Cost{{AccountName: "foo", Amount: 1}},
+			ForecastPeriod: &types.DateInterval{Start: aws.String("2024-02-20"), End: aws.String("2024-03-01")},
+			Forecasts:      forecasts,
+			Metric:         UnblendedCost,
+		}
+	}
+	if err := history.SaveSnapshot(report("2024-02-12", map[string]float64{"foo": 100, "bar": 50}), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := history.Snapshot("2024-02-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := snapshot.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored.Period.Start != "2024-02-12" || stored.Forecasts["foo"] != 100 {
+		t.Errorf("stored = %+v", stored)
+	}
+
+	// Another config sharing the store neither sees nor overwrites the
+	// snapshot.
+	byTeam := &Config{GroupBy: &types.GroupDefinition{Type: types.GroupDefinitionTypeTag, Key: aws.String("team")}}
+	other := &CostHistory{store: store, query: newReportQuery(byTeam)}
+	if _, err := other.Snapshot("2024-02-12"); !errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("Snapshot() of another config error = %v, want %v", err, ErrHistoryNotFound)
+	}
+	if err := other.SaveSnapshot(report("2024-02-12", map[string]float64{"web": 10}), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	withFilter := &Config{Filter: &types.Expression{Dimensions: &types.DimensionValues{Key: types.DimensionService, Values: []string{"Amazon EC2"}}}}
+	tests := []struct {
+		name    string
+		history *CostHistory
+		day     string
+		want    *PreviousForecast
+	}{
+		{"a week later", history, "2024-02-19", &PreviousForecast{Date: "2024-02-12", Total: 150}},
+		{"no snapshot", history, "2024-02-20", nil},
+		{"another grouping", other, "2024-02-19", &PreviousForecast{Date: "2024-02-12", Total: 10}},
+		{"another filter", &CostHistory{store: store, query: newReportQuery(withFilter)}, "2024-02-19", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.history.PreviousForecast(report(tt.day, map[string]float64{"foo": 120}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PreviousForecast() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_previousForecast(t *testing.T) {
+	query := newReportQuery(&Config{})
+	snapshot := &Snapshot{
+		Period:         &jsonPeriod{Start: "2024-02-12", End: "2024-02-13"},
+		Query:          query,
+		ForecastPeriod: &jsonPeriod{Start: "2024-02-14", End: "2024-03-01"},
+		Forecasts:      map[string]float64{"foo": 100},
+	}
+	// Read back from JSON, as snapshots are.
+	buf, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Snapshot
+	if err := json.Unmarshal(buf, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	grossQuery := newReportQuery(&Config{Gross: true})
+	byService := newReportQuery(&Config{GroupBy: &types.GroupDefinition{Type: types.GroupDefinitionTypeDimension, Key: aws.String("SERVICE")}})
+	tests := []struct {
+		name        string
+		query       reportQuery
+		forecastEnd string
+		want        *PreviousForecast
+	}{
+		{"same query", query, "2024-03-01", &PreviousForecast{Date: "2024-02-12", Total: 100}},
+		{"another month", query, "2024-04-01", nil},
+		{"gross", grossQuery, "2024-03-01", nil},
+		{"another grouping", byService, "2024-03-01", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := previousForecast(&stored, tt.query, tt.forecastEnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("previousForecast() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// usageItem is a line of the cost and usage data served by the fake Cost
+// Explorer of Test_reportTotalsReconcile.
+type usageItem struct {
+	accountId string
+	service   string
+	amount    string
+}
+
+// matchesFilter evaluates the subset of filter expressions used by the
+// report filter.
+func matchesFilter(expr *types.Expression, item usageItem) bool {
+	switch {
+	case expr == nil:
+		return true
+	case expr.Not != nil:
+		return !matchesFilter(expr.Not, item)
+	case expr.And != nil:
+		for i := range expr.And {
+			if !matchesFilter(&expr.And[i], item) {
+				return false
+			}
+		}
+		return true
+	case expr.Dimensions != nil && expr.Dimensions.Key == types.DimensionService:
+		for _, v := range expr.Dimensions.Values {
+			if v == item.service {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func Test_reportTotalsReconcile(t *testing.T) {
+	now := time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)
+	items := []usageItem{
+		{"111111111111", "Amazon EC2", "10.5"},
+		{"111111111111", "Tax", "1.05"},
+		{"222222222222", "Amazon S3", "2.25"},
+		{"222222222222", "Tax", "0.23"},
+	}
+	metric := UnblendedCost
+	tests := []struct {
+		name         string
+		cfg          *Config
+		wantTotal    float64
+		wantExcluded float64
+	}{
+		{"tax excluded by default", &Config{}, 12.75, 1.28},
+		{"custom filter", &Config{Filter: &types.Expression{Dimensions: &types.DimensionValues{Key: types.DimensionService, Values: []string{"Amazon EC2", "Tax"}}}}, 11.78, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := NewCostOfTwoDaysAgo(tt.cfg, nil, now)
+			graph := NewCostGraphRenderer(tt.cfg, nil, now)
+			textInput := text.getCostAndUsageInput()
+			graphInput := graph.getCostAndUsageInput()
+			if !reflect.DeepEqual(textInput.Filter, graphInput.Filter) {
+				t.Fatalf("filters differ: text %+v, graph %+v", textInput.Filter, graphInput.Filter)
+			}
+
+			// Serve the same data to both queries, grouped as each asks.
+			day := types.DateInterval{Start: text.Period().Start, End: text.Period().End}
+			textResult := types.ResultByTime{TimePeriod: &day}
+			graphResult := types.ResultByTime{TimePeriod: &day}
+			byAccount := map[string]float64{}
+			for _, item := range items {
+				if !matchesFilter(textInput.Filter, item) {
+					continue
+				}
+				textResult.Groups = append(textResult.Groups, types.Group{
+					Keys:    []string{item.accountId, item.service},
+					Metrics: map[string]types.MetricValue{metric: {Amount: aws.String(item.amount)}},
+				})
+				amount, _ := strconv.ParseFloat(item.amount, 64)
+				byAccount[item.accountId] += amount
+			}
+			for _, accountId := range sortedKeys(byAccount) {
+				graphResult.Groups = append(graphResult.Groups, types.Group{
+					Keys:    []string{accountId},
+					Metrics: map[string]types.MetricValue{metric: {Amount: aws.String(strconv.FormatFloat(byAccount[accountId], 'f', -1, 64))}},
+				})
+			}
+
+			costs, err := text.transformToCosts(&costexplorer.GetCostAndUsageOutput{ResultsByTime: []types.ResultByTime{textResult}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			dailyCosts, err := graph.transformToCosts(graphInput.GroupBy[0], nil, []types.ResultByTime{graphResult})
+			if err != nil {
+				t.Fatal(err)
+			}
+			textTotal, graphTotal := 0.0, 0.0
+			for _, c := range costs {
+				textTotal += c.Amount
+			}
+			for _, c := range dailyCosts[0].Costs {
+				graphTotal += c.Amount
+			}
+			if math.Abs(textTotal-tt.wantTotal) > 1e-9 || math.Abs(graphTotal-tt.wantTotal) > 1e-9 {
+				t.Errorf("text total = %v, graph total = %v, want %v", textTotal, graphTotal, tt.wantTotal)
+			}
+
+			// The record type breakdown lists Tax and reconciles with the total.
+			recordTypeCosts := []Cost{}
+			for _, item := range items {
+				if !matchesFilter(tt.cfg.RecordTypeFilter(), item) {
+					continue
+				}
+				recordType := "Usage"
+				if item.service == "Tax" {
+					recordType = "Tax"
+				}
+				amount, _ := strconv.ParseFloat(item.amount, 64)
+				recordTypeCosts = append(recordTypeCosts, Cost{RecordType: recordType, Amount: amount})
+			}
+			breakdown := recordTypeBreakdown(recordTypeCosts, textTotal, false)
+			if math.Abs(breakdown.Excluded-tt.wantExcluded) > 1e-9 {
+				t.Errorf("record type breakdown Excluded = %v, want %v", breakdown.Excluded, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func Test_valueGroups(t *testing.T) {
+	key := aws.String("team")
+	filter := func(value string) *types.Expression {
+		if value == "" {
+			return &types.Expression{Tags: &types.TagValues{Key: key, MatchOptions: []types.MatchOption{types.MatchOptionAbsent}}}
+		}
+		return &types.Expression{Tags: &types.TagValues{Key: key, Values: []string{value}}}
+	}
+	got := valueGroups([]string{"", "web", "batch"}, UntaggedLabel, filter)
+	want := []Group{
+		{Name: "web", Filter: filter("web")},
+		{Name: "batch", Filter: filter("batch")},
+		{Name: UntaggedLabel, Filter: filter("")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("valueGroups() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_seriesColorsCollision(t *testing.T) {
+	colors := []color.Color{
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 255, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+		color.RGBA{0, 0, 0, 255},
+	}
+	slot := func(key string) uint32 {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return h.Sum32() % uint32(len(colors))
+	}
+	// Find two ids whose hashes pick the same color.
+	var a, b string
+	seen := map[uint32]string{}
+	for i := 0; a == ""; i++ {
+		id := fmt.Sprintf("%012d", i)
+		if other, ok := seen[slot(id)]; ok {
+			a, b = other, id
+		}
+		seen[slot(id)] = id
+	}
+	ids := map[string]string{"a": a, "b": b}
+
+	// Adding a series whose hash collides must not change the colors of the
+	// existing series.
+	before := seriesColors([]string{"a"}, ids, colors, nil)
+	after := seriesColors([]string{"b", "a"}, ids, colors, nil)
+	if after["a"] != before["a"] || after["a"] != colors[slot(a)] {
+		t.Errorf("seriesColors() a = %v, want its hashed color %v", after["a"], colors[slot(a)])
+	}
+	if after["b"] != colors[slot(b)] {
+		t.Errorf("seriesColors() b = %v, want its hashed color %v", after["b"], colors[slot(b)])
+	}
+}
+
+func TestCostGraphRenderer_EndsAtLatestDay(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		cfg  *Config
+		want bool
+	}{
+		{"default window", &Config{}, true},
+		{"custom window ending months ago", &Config{GetCostAndUsageInput: &costexplorer.GetCostAndUsageInput{
+			TimePeriod: &types.DateInterval{Start: aws.String("2023-01-01"), End: aws.String("2023-04-01")},
+		}}, false},
+		{"custom window ending at the latest day", &Config{GetCostAndUsageInput: &costexplorer.GetCostAndUsageInput{
+			TimePeriod: &types.DateInterval{Start: aws.String("2024-01-01"), End: aws.String("2024-05-09")},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewCostGraphRenderer(tt.cfg, nil, now).EndsAtLatestDay(); got != tt.want {
+				t.Errorf("EndsAtLatestDay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cumulativeCostsFromResults(t *testing.T) {
+	results := []types.ResultByTime{}
+	for _, day := range []string{"2024-01-30", "2024-01-31", "2024-02-01", "2024-02-02"} {
+		start, _ := time.Parse("2006-01-02", day)
+		amount := strconv.Itoa(start.Day())
+		results = append(results, types.ResultByTime{
+			TimePeriod: &types.DateInterval{Start: aws.String(day), End: aws.String(start.AddDate(0, 0, 1).Format("2006-01-02"))},
+			Groups: []types.Group{
+				{Keys: []string{"111111111111"}, Metrics: map[string]types.MetricValue{UnblendedCost: {Amount: aws.String(amount)}}},
+			},
+		})
+	}
+	c := NewCostGraphRenderer(&Config{}, nil, time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC))
+	dailyCosts, err := c.transformToCosts(types.GroupDefinition{Type: types.GroupDefinitionTypeDimension, Key: aws.String(LinkedAccount)}, nil, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		month time.Time
+		want  plotter.XYs
+	}{
+		{"previous month ends with its last day", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), plotter.XYs{{X: 30, Y: 30}, {X: 31, Y: 61}}},
+		{"month starts with its first day", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), plotter.XYs{{X: 1, Y: 1}, {X: 2, Y: 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cumulativeCosts(dailyCosts, tt.month); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cumulativeCosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_drawHeatmapWithNegativeDay(t *testing.T) {
+	dailyCosts := []DailyCosts{}
+	for i, amount := range []float64{5, -3, 0, 8} {
+		date := time.Date(2022, 11, 7, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		dailyCosts = append(dailyCosts, DailyCosts{Date: &date, Costs: []Cost{{AccountName: "a", Amount: amount}}})
+	}
+	c := newCalendar(dailyCosts, "")
+	if c.Values[0][1] != -3 {
+		t.Fatalf("newCalendar() Tuesday = %v, want -3", c.Values[0][1])
+	}
+	// The negative day is within the color range instead of under it.
+	if c.Min() != -3 || c.Max() != 8 {
+		t.Errorf("calendar range = [%v, %v], want [-3, 8]", c.Min(), c.Max())
+	}
+
+	opts := chartOptions{
+		Title:    "heatmap",
+		Currency: defaultCurrency(),
+		Image:    ChartImage{Format: ChartFormatPNG, Width: 800, Height: 400},
+	}
+	if _, err := drawHeatmap(opts, dailyCosts); err != nil {
+		t.Errorf("drawHeatmap() error = %v", err)
+	}
+}
+
+func Test_collectRecommendations(t *testing.T) {
+	savingsPlans := []Recommendation{{Type: SavingsPlansLabel, Description: "Purchase", EstimatedMonthlySavings: 10}}
+	ok := func() ([]Recommendation, error) { return savingsPlans, nil }
+	fail := func() ([]Recommendation, error) { return nil, fmt.Errorf("rightsizing is not enabled") }
+
+	got, err := collectRecommendations(5, map[string]func() ([]Recommendation, error){
+		RightsizingLabel:  fail,
+		SavingsPlansLabel: ok,
+	})
+	if err != nil {
+		t.Fatalf("collectRecommendations() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, savingsPlans) {
+		t.Errorf("collectRecommendations() = %v, want %v", got, savingsPlans)
+	}
+
+	if _, err := collectRecommendations(5, map[string]func() ([]Recommendation, error){
+		RightsizingLabel:  fail,
+		SavingsPlansLabel: fail,
+	}); err == nil {
+		t.Errorf("collectRecommendations() error = nil, want an error when both fail")
+	}
+}
+
+func TestCostHistory_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	history := (&CostHistory{store: &fileHistoryStore{dir: dir}, query: newReportQuery(&Config{})}).ReadOnly()
+	report := &Report{
+		Period: &types.DateInterval{Start: aws.String("2024-02-12"), End: aws.String("2024-02-13")},
+		Metric: UnblendedCost,
+	}
+	if err := history.SaveSnapshot(report, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	input := &costexplorer.GetCostAndUsageInput{
+		Granularity: types.GranularityDaily,
+		TimePeriod:  &types.DateInterval{Start: aws.String("2024-02-01"), End: aws.String("2024-02-03")},
+	}
+	fetch := func(input *costexplorer.GetCostAndUsageInput) ([]DailyCosts, error) {
+		date := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+		return []DailyCosts{{Date: &date, Costs: []Cost{{AccountName: "foo", Amount: 1}}}}, nil
+	}
+	if _, err := history.DailyCosts(input, fetch); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("read-only history wrote %d entries", len(entries))
+	}
+}
+
+func Test_s3HistoryStore(t *testing.T) {
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/denied.json"):
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+		case r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+		case objects[r.URL.Path] != nil:
+			w.Write(objects[r.URL.Path])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		}
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	store := &s3HistoryStore{client: client, bucket: "bucket", prefix: "awscost"}
+
+	if err := store.Put("snapshots/2024-02-12.json", []byte(`{}`)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, ok := objects["/bucket/awscost/snapshots/2024-02-12.json"]; !ok {
+		t.Errorf("Put() stored %v, want the key under the prefix", objects)
+	}
+	got, err := store.Get("snapshots/2024-02-12.json")
+	if err != nil || string(got) != `{}` {
+		t.Errorf("Get() = %q, %v, want the stored object", got, err)
+	}
+	if _, err := store.Get("snapshots/missing.json"); !errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("Get() of a missing key error = %v, want %v", err, ErrHistoryNotFound)
+	}
+	// Without s3:ListBucket, S3 denies missing keys, which must not be taken
+	// as an empty history.
+	if _, err := store.Get("denied.json"); err == nil || errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("Get() of a denied key error = %v, want an error other than %v", err, ErrHistoryNotFound)
+	}
+}
+
+// failingHistoryStore fails every read and write.
+type failingHistoryStore struct{}
+
+func (failingHistoryStore) Get(key string) ([]byte, error) {
+	return nil, fmt.Errorf("access denied")
+}
+
+func (failingHistoryStore) Put(key string, body []byte) error {
+	return fmt.Errorf("access denied")
+}
+
+func TestCostHistory_errors(t *testing.T) {
+	history := &CostHistory{store: failingHistoryStore{}, query: newReportQuery(&Config{})}
+
+	// Daily costs are fetched for the whole period instead.
+	input := &costexplorer.GetCostAndUsageInput{
+		Granularity: types.GranularityDaily,
+		TimePeriod:  &types.DateInterval{Start: aws.String("2024-02-01"), End: aws.String("2024-02-03")},
+	}
+	var fetched []string
+	fetch := func(input *costexplorer.GetCostAndUsageInput) ([]DailyCosts, error) {
+		fetched = append(fetched, *input.TimePeriod.Start)
+		date := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+		return []DailyCosts{{Date: &date, Costs: []Cost{{AccountName: "foo", Amount: 1}}}}, nil
+	}
+	got, err := history.DailyCosts(input, fetch)
+	if err != nil {
+		t.Fatalf("DailyCosts() error = %v", err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(fetched, []string{"2024-02-01"}) {
+		t.Errorf("DailyCosts() = %v, fetched %v, want the whole period fetched", got, fetched)
+	}
+
+	// A failed read is not taken as a missing snapshot.
+	if _, err := history.Snapshot("2024-02-12"); err == nil || errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("Snapshot() error = %v, want the store error", err)
+	}
+	report := &Report{
+		Period:         &types.DateInterval{Start: aws.String("2024-02-19"), End: aws.String("2024-02-20")},
+		ForecastPeriod: &types.DateInterval{Start: aws.String("2024-02-21"), End: aws.String("2024-03-01")},
+		Metric:         UnblendedCost,
+	}
+	if _, err := history.PreviousForecast(report); err == nil {
+		t.Errorf("PreviousForecast() error = nil, want the store error")
+	}
+	if err := history.SaveSnapshot(report, time.Now()); err == nil {
+		t.Errorf("SaveSnapshot() error = nil, want the store error")
+	}
+}
+
+func Test_outputSnapshot(t *testing.T) {
+	cfg := &Config{Locale: "en"}
+	history := &CostHistory{store: &fileHistoryStore{dir: t.TempDir()}, query: newReportQuery(cfg)}
+	report := func(day string, forecast float64) *Report {
+		return &Report{
+			Period:         &types.DateInterval{Start: aws.String(day), End: aws.String(day)},
+			Costs:          []Cost{{AccountId: "111111111111", AccountName: "foo", ServiceName: "Amazon EC2", Amount: 12.5}},
+			ForecastPeriod: &types.DateInterval{Start: aws.String("2024-02-20"), End: aws.String("2024-03-01")},
+			Forecasts:      map[string]float64{"foo": forecast},
+			Metric:         UnblendedCost,
+		}
+	}
+	for day, forecast := range map[string]float64{"2024-02-12": 300, "2024-02-19": 320} {
+		if err := history.SaveSnapshot(report(day, forecast), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := NewMessages(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currency, err := NewCurrency(cfg, messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textRenderer, err := NewTextRenderer(cfg, messages, currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		want   []string
+	}{
+		{"text", OutputFormatText, []string{"February 19, 2024", "$12.50", "Forecast for February: $320.00", "(Forecast on February 12, 2024: $300.00, +20.00)"}},
+		{"json", OutputFormatJSON, []string{`"start": "2024-02-19"`, `"amount": 12.5`, `"foo": 320`, `"date": "2024-02-12"`, `"total": 300`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/report"
+			t.Setenv("OUTPUT_FORMAT", tt.format)
+			t.Setenv("OUTPUT_PATH", path)
+			t.Setenv("DISABLE_FORECAST", "")
+			if err := outputSnapshot(history, "2024-02-19", textRenderer, currency); err != nil {
+				t.Fatalf("outputSnapshot() error = %v", err)
+			}
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(buf), s) {
+					t.Errorf("outputSnapshot() output does not contain %q:\n%s", s, buf)
+				}
+			}
+		})
+	}
+
+	if err := outputSnapshot(history, "2024-01-01", textRenderer, currency); !errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("outputSnapshot() of a day without snapshot error = %v, want %v", err, ErrHistoryNotFound)
+	}
+}
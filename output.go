@@ -0,0 +1,679 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+const (
+	OutputFormatText     = "text"
+	OutputFormatJSON     = "json"
+	OutputFormatCSV      = "csv"
+	OutputFormatMarkdown = "markdown"
+	OutputFormatHTML     = "html"
+)
+
+var outputFormats = []string{
+	OutputFormatText,
+	OutputFormatJSON,
+	OutputFormatCSV,
+	OutputFormatMarkdown,
+	OutputFormatHTML,
+}
+
+// Report holds everything fetched in a single run.
+type Report struct {
+	Period         *types.DateInterval
+	Costs          []Cost
+	ForecastPeriod *types.DateInterval
+	Forecasts      map[string]float64
+	DailyCosts     []DailyCosts
+	// DailyForecasts is the daily forecast of the total costs for the rest
+	// of the month, drawn after DailyCosts.
+	DailyForecasts []DailyForecast
+	// ServiceDailyCosts are the daily costs by service over the same window
+	// as DailyCosts. It is only fetched when the service chart is enabled.
+	ServiceDailyCosts []DailyCosts
+	// RegionCosts are the costs of the report day by region. It is only
+	// fetched when RegionReport is enabled.
+	RegionCosts []Cost
+	// RecordTypeCosts are the costs of the report day by record type. It is
+	// only fetched when RecordTypeBreakdown is enabled.
+	RecordTypeCosts []Cost
+	// RegionDailyCosts are the daily costs by region over the same window as
+	// DailyCosts. It is only fetched when the region chart is enabled.
+	RegionDailyCosts []DailyCosts
+	// ServiceBreakdown is the top services of each of the top accounts.
+	ServiceBreakdown []AccountBreakdown
+	// Commitments are the Savings Plans and Reserved Instances of the report
+	// day. It is only fetched when Commitments is enabled.
+	Commitments []Commitment
+	// Recommendations are the rightsizing and Savings Plans purchase
+	// recommendations. It is only fetched on the recommendation day.
+	Recommendations []Recommendation
+	// DrillDowns are the usage types and operations of the most changed
+	// services. It is only fetched when DrillDown is enabled.
+	DrillDowns []DrillDown
+	// Annotations are the events marked on the daily cost charts.
+	Annotations []Annotation
+	// Month is the current month of the cumulative chart.
+	Month time.Time
+	// LastYearDailyCosts are the daily costs of Month a year before. It is
+	// only fetched when the cumulative chart is enabled.
+	LastYearDailyCosts []DailyCosts
+	Metric             string
+	// Gross tells that credits and refunds are excluded from the costs.
+	Gross bool
+	// GroupBy is the tag or dimension costs are grouped by, or empty when
+	// grouped by account.
+	GroupBy string
+	// PreviousForecast is the forecast of the same month reported a week
+	// before. It is only read when History is configured.
+	PreviousForecast *PreviousForecast
+	// Currency is the currency of the amounts. Nil means USD.
+	Currency *Currency
+	// Messages is the catalog of the markdown and html outputs. Nil means
+	// the default locale.
+	Messages *Messages
+}
+
+// ConvertTo returns a copy of the report with all amounts converted from USD
+// to the currency.
+func (r *Report) ConvertTo(currency *Currency) *Report {
+	converted := *r
+	converted.Currency = currency
+	converted.Costs = convertCosts(r.Costs, currency)
+	if r.Forecasts != nil {
+		converted.Forecasts = map[string]float64{}
+		for k, v := range r.Forecasts {
+			converted.Forecasts[k] = currency.Convert(v)
+		}
+	}
+	if r.PreviousForecast != nil {
+		converted.PreviousForecast = &PreviousForecast{Date: r.PreviousForecast.Date, Total: currency.Convert(r.PreviousForecast.Total)}
+	}
+	converted.DailyCosts = convertDailyCosts(r.DailyCosts, currency)
+	converted.ServiceDailyCosts = convertDailyCosts(r.ServiceDailyCosts, currency)
+	if r.RegionCosts != nil {
+		converted.RegionCosts = convertCosts(r.RegionCosts, currency)
+	}
+	if r.RecordTypeCosts != nil {
+		converted.RecordTypeCosts = convertCosts(r.RecordTypeCosts, currency)
+	}
+	converted.RegionDailyCosts = convertDailyCosts(r.RegionDailyCosts, currency)
+	converted.LastYearDailyCosts = convertDailyCosts(r.LastYearDailyCosts, currency)
+	if r.DrillDowns != nil {
+		converted.DrillDowns = make([]DrillDown, len(r.DrillDowns))
+		for i, d := range r.DrillDowns {
+			converted.DrillDowns[i] = d
+			converted.DrillDowns[i].Amount = currency.Convert(d.Amount)
+			converted.DrillDowns[i].Previous = currency.Convert(d.Previous)
+			converted.DrillDowns[i].Items = make([]UsageCost, len(d.Items))
+			for j, item := range d.Items {
+				converted.DrillDowns[i].Items[j] = item
+				converted.DrillDowns[i].Items[j].Amount = currency.Convert(item.Amount)
+				converted.DrillDowns[i].Items[j].Previous = currency.Convert(item.Previous)
+			}
+		}
+	}
+	if r.Commitments != nil {
+		converted.Commitments = make([]Commitment, len(r.Commitments))
+		for i, c := range r.Commitments {
+			converted.Commitments[i] = c
+			converted.Commitments[i].OnDemandCost = currency.Convert(c.OnDemandCost)
+			converted.Commitments[i].UnusedCost = currency.Convert(c.UnusedCost)
+		}
+	}
+	if r.Recommendations != nil {
+		converted.Recommendations = make([]Recommendation, len(r.Recommendations))
+		for i, rec := range r.Recommendations {
+			converted.Recommendations[i] = rec
+			converted.Recommendations[i].HourlyCommitment = currency.Convert(rec.HourlyCommitment)
+			converted.Recommendations[i].EstimatedMonthlySavings = currency.Convert(rec.EstimatedMonthlySavings)
+		}
+	}
+	if r.ServiceBreakdown != nil {
+		converted.ServiceBreakdown = make([]AccountBreakdown, len(r.ServiceBreakdown))
+		for i, b := range r.ServiceBreakdown {
+			converted.ServiceBreakdown[i] = b
+			converted.ServiceBreakdown[i].Amount = currency.Convert(b.Amount)
+			converted.ServiceBreakdown[i].Services = make([]ServiceShare, len(b.Services))
+			for j, s := range b.Services {
+				converted.ServiceBreakdown[i].Services[j] = s
+				converted.ServiceBreakdown[i].Services[j].Amount = currency.Convert(s.Amount)
+			}
+		}
+	}
+	if r.DailyForecasts != nil {
+		converted.DailyForecasts = make([]DailyForecast, len(r.DailyForecasts))
+		for i, f := range r.DailyForecasts {
+			converted.DailyForecasts[i] = DailyForecast{
+				Date:  f.Date,
+				Mean:  currency.Convert(f.Mean),
+				Lower: currency.Convert(f.Lower),
+				Upper: currency.Convert(f.Upper),
+			}
+		}
+	}
+	return &converted
+}
+
+func convertDailyCosts(dailyCosts []DailyCosts, currency *Currency) []DailyCosts {
+	if dailyCosts == nil {
+		return nil
+	}
+	converted := make([]DailyCosts, len(dailyCosts))
+	for i, dc := range dailyCosts {
+		converted[i] = DailyCosts{Date: dc.Date, Costs: convertCosts(dc.Costs, currency), Estimated: dc.Estimated}
+	}
+	return converted
+}
+
+func convertCosts(costs []Cost, currency *Currency) []Cost {
+	converted := make([]Cost, len(costs))
+	for i, c := range costs {
+		converted[i] = c
+		converted[i].Amount = currency.Convert(c.Amount)
+	}
+	return converted
+}
+
+func (r *Report) currency() *Currency {
+	if r.Currency == nil {
+		return defaultCurrency()
+	}
+	return r.Currency
+}
+
+// metricLabel returns the metric, noting when credits and refunds are
+// excluded, for the total and the chart titles.
+func (r *Report) metricLabel() string {
+	if r.Gross {
+		return r.Metric + ", gross"
+	}
+	return r.Metric
+}
+
+func validateOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q: must be one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+// writeOutput writes the report to the file at path, or to stdout when path
+// is empty. Errors of closing the file are returned, since they may tell
+// that the written output was lost.
+func writeOutput(format string, path string, report *Report, text string) (err error) {
+	if path == "" {
+		return renderOutput(os.Stdout, format, report, text)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return renderOutput(f, format, report, text)
+}
+
+func renderOutput(w io.Writer, format string, report *Report, text string) error {
+	switch format {
+	case OutputFormatText:
+		_, err := fmt.Fprintln(w, text)
+		return err
+	case OutputFormatJSON:
+		return renderJSON(w, report)
+	case OutputFormatCSV:
+		return renderCSV(w, report)
+	case OutputFormatMarkdown:
+		return renderMarkdown(w, report)
+	case OutputFormatHTML:
+		return renderHTML(w, report)
+	default:
+		return validateOutputFormat(format)
+	}
+}
+
+type jsonPeriod struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type jsonDailyCosts struct {
+	Date      string `json:"date"`
+	Costs     []Cost `json:"costs"`
+	Estimated bool   `json:"estimated,omitempty"`
+}
+
+func newJSONDailyCosts(dailyCosts []DailyCosts) []jsonDailyCosts {
+	out := []jsonDailyCosts{}
+	for _, dc := range dailyCosts {
+		out = append(out, jsonDailyCosts{Date: dc.Date.Format("2006-01-02"), Costs: dc.Costs, Estimated: dc.Estimated})
+	}
+	return out
+}
+
+type jsonDailyForecast struct {
+	Date  string  `json:"date"`
+	Mean  float64 `json:"mean"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+type jsonReport struct {
+	Period             *jsonPeriod          `json:"period"`
+	Currency           string               `json:"currency"`
+	Metric             string               `json:"metric"`
+	Gross              bool                 `json:"gross,omitempty"`
+	Total              float64              `json:"total"`
+	Costs              []Cost               `json:"costs"`
+	ForecastPeriod     *jsonPeriod          `json:"forecast_period,omitempty"`
+	Forecasts          map[string]float64   `json:"forecasts,omitempty"`
+	PreviousForecast   *PreviousForecast    `json:"previous_forecast,omitempty"`
+	DailyCosts         []jsonDailyCosts     `json:"daily_costs"`
+	ServiceDailyCosts  []jsonDailyCosts     `json:"service_daily_costs,omitempty"`
+	RegionCosts        []Cost               `json:"region_costs,omitempty"`
+	RecordTypes        *RecordTypeBreakdown `json:"record_types,omitempty"`
+	RegionDailyCosts   []jsonDailyCosts     `json:"region_daily_costs,omitempty"`
+	DailyForecasts     []jsonDailyForecast  `json:"daily_forecasts,omitempty"`
+	LastYearDailyCosts []jsonDailyCosts     `json:"last_year_daily_costs,omitempty"`
+	ServiceBreakdown   []AccountBreakdown   `json:"service_breakdown,omitempty"`
+	Commitments        []Commitment         `json:"commitments,omitempty"`
+	Recommendations    []Recommendation     `json:"recommendations,omitempty"`
+	DrillDowns         []DrillDown          `json:"drill_downs,omitempty"`
+}
+
+func newJSONPeriod(period *types.DateInterval) *jsonPeriod {
+	if period == nil {
+		return nil
+	}
+	return &jsonPeriod{Start: *period.Start, End: *period.End}
+}
+
+func (p *jsonPeriod) dateInterval() *types.DateInterval {
+	return &types.DateInterval{Start: aws.String(p.Start), End: aws.String(p.End)}
+}
+
+func renderJSON(w io.Writer, report *Report) error {
+	out := jsonReport{
+		Period:           newJSONPeriod(report.Period),
+		Currency:         report.currency().Code,
+		Metric:           report.Metric,
+		Gross:            report.Gross,
+		RecordTypes:      recordTypeBreakdown(report.RecordTypeCosts, sum(report.Costs), report.Gross),
+		Costs:            report.Costs,
+		ForecastPeriod:   newJSONPeriod(report.ForecastPeriod),
+		Forecasts:        report.Forecasts,
+		PreviousForecast: report.PreviousForecast,
+		DailyCosts:       newJSONDailyCosts(report.DailyCosts),
+		RegionCosts:      report.RegionCosts,
+		ServiceBreakdown: report.ServiceBreakdown,
+		Commitments:      report.Commitments,
+		Recommendations:  report.Recommendations,
+		DrillDowns:       report.DrillDowns,
+	}
+	for _, c := range report.Costs {
+		out.Total += c.Amount
+	}
+	if report.ServiceDailyCosts != nil {
+		out.ServiceDailyCosts = newJSONDailyCosts(report.ServiceDailyCosts)
+	}
+	if report.RegionDailyCosts != nil {
+		out.RegionDailyCosts = newJSONDailyCosts(report.RegionDailyCosts)
+	}
+	if report.LastYearDailyCosts != nil {
+		out.LastYearDailyCosts = newJSONDailyCosts(report.LastYearDailyCosts)
+	}
+	for _, f := range report.DailyForecasts {
+		out.DailyForecasts = append(out.DailyForecasts, jsonDailyForecast{Date: f.Date.Format("2006-01-02"), Mean: f.Mean, Lower: f.Lower, Upper: f.Upper})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// renderCSV writes one row per amount. The record column tells which part of
+// the report the row comes from (cost, forecast or daily).
+func renderCSV(w io.Writer, report *Report) error {
+	currency := report.currency()
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"record", "date", "account_id", "account_name", "service", "amount", "currency"}); err != nil {
+		return err
+	}
+	for _, c := range report.Costs {
+		if err := cw.Write([]string{"cost", *report.Period.Start, c.AccountId, c.AccountName, c.ServiceName, currency.FormatPlain(c.Amount), currency.Code}); err != nil {
+			return err
+		}
+	}
+	if report.ForecastPeriod != nil {
+		for _, name := range sortedKeys(report.Forecasts) {
+			if err := cw.Write([]string{"forecast", *report.ForecastPeriod.End, "", name, "", currency.FormatPlain(report.Forecasts[name]), currency.Code}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, dc := range report.DailyCosts {
+		for _, c := range dc.Costs {
+			if err := cw.Write([]string{"daily", dc.Date.Format("2006-01-02"), c.AccountId, c.AccountName, c.ServiceName, currency.FormatPlain(c.Amount), currency.Code}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// reportData returns the template data of the report.
+func reportData(report *Report) (*TemplateData, error) {
+	data, err := templateData(report.Forecasts, report.Costs, report.ForecastPeriod, report.Period)
+	if err != nil {
+		return nil, err
+	}
+	data.Metric = report.metricLabel()
+	data.GroupBy = report.GroupBy
+	data.messages = report.Messages
+	data.currency = report.Currency
+	if !data.ReportDate.IsZero() {
+		data.Date = data.msg().FormatDate(data.ReportDate)
+	}
+	data.PreviousForecast = report.PreviousForecast
+	data.CostsByRegion = costsByRegion(report.RegionCosts)
+	data.RecordTypes = recordTypeBreakdown(report.RecordTypeCosts, data.Total, report.Gross)
+	data.ServiceBreakdown = report.ServiceBreakdown
+	data.Commitments = report.Commitments
+	data.Recommendations = report.Recommendations
+	data.DrillDowns = report.DrillDowns
+	return data, nil
+}
+
+// outputTables builds the tables shared by the markdown and html formats.
+func outputTables(report *Report) (*TemplateData, [][]string, error) {
+	data, err := reportData(report)
+	if err != nil {
+		return nil, nil, err
+	}
+	daily := [][]string{}
+	for _, dc := range report.DailyCosts {
+		total := 0.0
+		for _, c := range dc.Costs {
+			total += c.Amount
+		}
+		daily = append(daily, []string{dc.Date.Format("2006-01-02"), report.currency().FormatNumber(total)})
+	}
+	return data, daily, nil
+}
+
+func renderMarkdown(w io.Writer, report *Report) error {
+	data, daily, err := outputTables(report)
+	if err != nil {
+		return err
+	}
+
+	currency := report.currency()
+	m := data.msg()
+	cost := m.Text("header_cost", currency.Code)
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "# %s\n\n", m.Text("title", data.Date))
+	fmt.Fprintf(b, "%s\n\n", m.Text("total", data.Date, currency.Format(data.Total), data.Metric))
+	if data.Estimated {
+		fmt.Fprintf(b, "%s\n\n", escapeMarkdown(m.Text("estimated")))
+	}
+
+	header := data.groupHeader()
+	fmt.Fprintf(b, "## %s\n\n", data.costsByGroupTitle())
+	if data.Forecasts == nil {
+		fmt.Fprintf(b, "| %s | %s |\n| --- | ---: |\n", header, cost)
+		for _, c := range data.CostsByAccount {
+			fmt.Fprintf(b, "| %s | %s |\n", escapeMarkdown(c.AccountName), escapeMarkdown(data.formatCost(c)))
+		}
+	} else {
+		fmt.Fprintf(b, "| %s | %s | %s |\n| --- | ---: | ---: |\n", header, cost, m.Text("header_forecast"))
+		for _, c := range data.CostsByAccount {
+			fmt.Fprintf(b, "| %s | %s | %s |\n", escapeMarkdown(c.AccountName), escapeMarkdown(data.formatCost(c)), currency.FormatNumber(data.Forecasts[c.AccountName]))
+		}
+	}
+
+	if len(data.CostsByRegion) > 0 {
+		fmt.Fprintf(b, "\n## %s\n\n| %s | %s |\n| --- | ---: |\n", m.Text("costs_by_region"), m.Text("header_region"), cost)
+		for _, c := range data.CostsByRegion {
+			fmt.Fprintf(b, "| %s | %s |\n", escapeMarkdown(c.Region), escapeMarkdown(data.formatCost(c)))
+		}
+	}
+
+	if data.RecordTypes != nil {
+		fmt.Fprintf(b, "\n## %s\n\n| %s | %s |\n| --- | ---: |\n", m.Text("record_types"), m.Text("header_record_type"), cost)
+		for _, c := range data.RecordTypes.RecordTypes {
+			fmt.Fprintf(b, "| %s | %s |\n", c.RecordType, escapeMarkdown(data.formatCost(c)))
+		}
+		total := func(amount float64) string {
+			return escapeMarkdown(data.formatCost(Cost{Amount: amount, Estimated: data.RecordTypes.Estimated}))
+		}
+		fmt.Fprintf(b, "| **%s** | %s |\n| **%s** | %s |\n| **%s** | %s |\n",
+			m.Text("gross"), total(data.RecordTypes.Gross),
+			m.Text("credits"), total(data.RecordTypes.Credits),
+			m.Text("net"), total(data.RecordTypes.Net))
+		if data.RecordTypes.Excluded != 0 {
+			fmt.Fprintf(b, "| **%s** | %s |\n", m.Text("excluded"), total(data.RecordTypes.Excluded))
+		}
+	}
+
+	fmt.Fprintf(b, "\n## %s\n\n| %s | %s | %s |\n| --- | --- | ---: |\n", m.Text("top_services"), m.Text("header_service"), header, cost)
+	for _, c := range data.CostsByServiceAndAccount {
+		fmt.Fprintf(b, "| %s | %s | %s |\n", escapeMarkdown(c.ServiceName), escapeMarkdown(c.AccountName), escapeMarkdown(data.formatCost(c)))
+	}
+
+	if len(data.ServiceBreakdown) > 0 {
+		fmt.Fprintf(b, "\n## %s\n\n| %s | %s | %s | %s |\n| --- | --- | ---: | ---: |\n", data.serviceBreakdownTitle(), header, m.Text("header_service"), cost, m.Text("header_share"))
+		for _, account := range data.ServiceBreakdown {
+			for _, s := range account.Services {
+				fmt.Fprintf(b, "| %s | %s | %s | %s |\n", escapeMarkdown(account.AccountName), escapeMarkdown(s.ServiceName), escapeMarkdown(data.formatCost(Cost{Amount: s.Amount, Estimated: s.Estimated})), data.formatShare(s.Share))
+			}
+		}
+	}
+
+	if len(data.Commitments) > 0 {
+		fmt.Fprintf(b, "\n## %s\n\n| %s | %s | %s | %s | %s |\n| --- | ---: | ---: | ---: | ---: |\n", m.Text("commitments"),
+			m.Text("header_commitment"), m.Text("header_utilization"), m.Text("header_coverage"), m.Text("header_on_demand", currency.Code), m.Text("header_unused", currency.Code))
+		for _, c := range data.Commitments {
+			fmt.Fprintf(b, "| %s | %s | %s | %s | %s |\n", c.Name, data.formatShare(c.Utilization), data.formatShare(c.Coverage), currency.FormatNumber(c.OnDemandCost), currency.FormatNumber(c.UnusedCost))
+		}
+	}
+
+	if len(data.Recommendations) > 0 {
+		fmt.Fprintf(b, "\n## %s\n\n| %s | %s | %s | %s |\n| --- | --- | --- | ---: |\n", m.Text("recommendations"),
+			m.Text("header_type"), m.Text("header_account"), m.Text("header_recommendation"), m.Text("header_savings", currency.Code))
+		for _, r := range data.Recommendations {
+			fmt.Fprintf(b, "| %s | %s | %s | %s |\n", r.Type, escapeMarkdown(data.recommendationAccount(r)), escapeMarkdown(r.Description), currency.FormatNumber(r.EstimatedMonthlySavings))
+		}
+	}
+
+	if len(data.DrillDowns) > 0 {
+		fmt.Fprintf(b, "\n## %s\n\n| %s | %s | %s | %s | %s |\n| --- | --- | --- | ---: | ---: |\n", m.Text("drill_down"),
+			m.Text("header_service"), m.Text("header_usage_type"), m.Text("header_operation"), cost, m.Text("header_change"))
+		for _, d := range data.DrillDowns {
+			fmt.Fprintf(b, "| %s | | | %s | %s |\n", escapeMarkdown(d.ServiceName), escapeMarkdown(data.formatCost(Cost{Amount: d.Amount, Estimated: d.Estimated})), data.formatChange(d.Change()))
+			for _, item := range d.Items {
+				fmt.Fprintf(b, "| | %s | %s | %s | %s |\n", escapeMarkdown(item.UsageType), escapeMarkdown(item.Operation), escapeMarkdown(data.formatCost(Cost{Amount: item.Amount, Estimated: d.Estimated})), data.formatChange(item.Change()))
+			}
+		}
+	}
+
+	if len(daily) > 0 {
+		fmt.Fprintf(b, "\n## %s\n\n| %s | %s |\n| --- | ---: |\n", m.Text("daily_costs"), m.Text("header_date"), cost)
+		for _, row := range daily {
+			fmt.Fprintf(b, "| %s | %s |\n", row[0], row[1])
+		}
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "*", "\\*").Replace(s)
+}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ msg "title" .Data.Date }}</title>
+</head>
+<body>
+<h1>{{ msg "title" .Data.Date }}</h1>
+<p>{{ msg "total" .Data.Date (formatCurrency .Data.Total) .Data.Metric }}</p>
+{{- if .Data.Estimated }}
+<p>{{ msg "estimated" }}</p>
+{{- end }}
+<h2>{{ .CostsByGroupTitle }}</h2>
+<table>
+<tr><th>{{ .Header }}</th><th>{{ .CostHeader }}</th>{{ if .Data.Forecasts }}<th>{{ msg "header_forecast" }}</th>{{ end }}</tr>
+{{- range .Data.CostsByAccount }}
+<tr><td>{{ .AccountName }}</td><td>{{ formatCost . }}</td>{{ if $.Data.Forecasts }}<td>{{ formatAmount (index $.Data.Forecasts .AccountName) }}</td>{{ end }}</tr>
+{{- end }}
+</table>
+{{- if .Data.CostsByRegion }}
+<h2>{{ msg "costs_by_region" }}</h2>
+<table>
+<tr><th>{{ msg "header_region" }}</th><th>{{ .CostHeader }}</th></tr>
+{{- range .Data.CostsByRegion }}
+<tr><td>{{ .Region }}</td><td>{{ formatCost . }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- with .Data.RecordTypes }}
+<h2>{{ msg "record_types" }}</h2>
+<table>
+<tr><th>{{ msg "header_record_type" }}</th><th>{{ $.CostHeader }}</th></tr>
+{{- range .RecordTypes }}
+<tr><td>{{ .RecordType }}</td><td>{{ formatCost . }}</td></tr>
+{{- end }}
+<tr><th>{{ msg "gross" }}</th><td>{{ formatEstimated .Gross .Estimated }}</td></tr>
+<tr><th>{{ msg "credits" }}</th><td>{{ formatEstimated .Credits .Estimated }}</td></tr>
+<tr><th>{{ msg "net" }}</th><td>{{ formatEstimated .Net .Estimated }}</td></tr>
+{{- if .Excluded }}
+<tr><th>{{ msg "excluded" }}</th><td>{{ formatEstimated .Excluded .Estimated }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+<h2>{{ msg "top_services" }}</h2>
+<table>
+<tr><th>{{ msg "header_service" }}</th><th>{{ .Header }}</th><th>{{ .CostHeader }}</th></tr>
+{{- range .Data.CostsByServiceAndAccount }}
+<tr><td>{{ .ServiceName }}</td><td>{{ .AccountName }}</td><td>{{ formatCost . }}</td></tr>
+{{- end }}
+</table>
+{{- if .Data.ServiceBreakdown }}
+<h2>{{ .ServiceBreakdownTitle }}</h2>
+<table>
+<tr><th>{{ .Header }}</th><th>{{ msg "header_service" }}</th><th>{{ .CostHeader }}</th><th>{{ msg "header_share" }}</th></tr>
+{{- range .Data.ServiceBreakdown }}
+{{- $account := .AccountName }}
+{{- range .Services }}
+<tr><td>{{ $account }}</td><td>{{ .ServiceName }}</td><td>{{ formatEstimated .Amount .Estimated }}</td><td>{{ formatShare .Share }}</td></tr>
+{{- end }}
+{{- end }}
+</table>
+{{- end }}
+{{- if .Data.Commitments }}
+<h2>{{ msg "commitments" }}</h2>
+<table>
+<tr><th>{{ msg "header_commitment" }}</th><th>{{ msg "header_utilization" }}</th><th>{{ msg "header_coverage" }}</th><th>{{ msg "header_on_demand" .Currency }}</th><th>{{ msg "header_unused" .Currency }}</th></tr>
+{{- range .Data.Commitments }}
+<tr><td>{{ .Name }}</td><td>{{ formatShare .Utilization }}</td><td>{{ formatShare .Coverage }}</td><td>{{ formatAmount .OnDemandCost }}</td><td>{{ formatAmount .UnusedCost }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Data.Recommendations }}
+<h2>{{ msg "recommendations" }}</h2>
+<table>
+<tr><th>{{ msg "header_type" }}</th><th>{{ msg "header_account" }}</th><th>{{ msg "header_recommendation" }}</th><th>{{ msg "header_savings" .Currency }}</th></tr>
+{{- range .Data.Recommendations }}
+<tr><td>{{ .Type }}</td><td>{{ recommendationAccount . }}</td><td>{{ .Description }}</td><td>{{ formatAmount .EstimatedMonthlySavings }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Data.DrillDowns }}
+<h2>{{ msg "drill_down" }}</h2>
+<table>
+<tr><th>{{ msg "header_service" }}</th><th>{{ msg "header_usage_type" }}</th><th>{{ msg "header_operation" }}</th><th>{{ .CostHeader }}</th><th>{{ msg "header_change" }}</th></tr>
+{{- range .Data.DrillDowns }}
+{{- $estimated := .Estimated }}
+<tr><td>{{ .ServiceName }}</td><td></td><td></td><td>{{ formatEstimated .Amount .Estimated }}</td><td>{{ formatChange .Change }}</td></tr>
+{{- range .Items }}
+<tr><td></td><td>{{ .UsageType }}</td><td>{{ .Operation }}</td><td>{{ formatEstimated .Amount $estimated }}</td><td>{{ formatChange .Change }}</td></tr>
+{{- end }}
+{{- end }}
+</table>
+{{- end }}
+{{- if .Daily }}
+<h2>{{ msg "daily_costs" }}</h2>
+<table>
+<tr><th>{{ msg "header_date" }}</th><th>{{ .CostHeader }}</th></tr>
+{{- range .Daily }}
+<tr><td>{{ index . 0 }}</td><td>{{ index . 1 }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`
+
+func renderHTML(w io.Writer, report *Report) error {
+	data, daily, err := outputTables(report)
+	if err != nil {
+		return err
+	}
+	currency := report.currency()
+	m := data.msg()
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"msg":            m.Text,
+		"formatAmount":   currency.FormatNumber,
+		"formatCurrency": currency.Format,
+		"formatShare":    data.formatShare,
+		"formatChange":   data.formatChange,
+		"formatCost":     data.formatCost,
+		"formatEstimated": func(amount float64, estimated bool) string {
+			return data.formatCost(Cost{Amount: amount, Estimated: estimated})
+		},
+		"recommendationAccount": data.recommendationAccount,
+	}).Parse(htmlTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, struct {
+		Data                  *TemplateData
+		Daily                 [][]string
+		Currency              string
+		Header                string
+		CostHeader            string
+		CostsByGroupTitle     string
+		ServiceBreakdownTitle string
+	}{data, daily, currency.Code, data.groupHeader(), m.Text("header_cost", currency.Code), data.costsByGroupTitle(), data.serviceBreakdownTitle()})
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
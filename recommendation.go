@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+const (
+	RightsizingLabel = "Rightsizing"
+
+	DefaultTopRecommendations = 5
+)
+
+// Recommendation is a rightsizing or Savings Plans purchase recommendation.
+type Recommendation struct {
+	Type        string `json:"type"`
+	AccountId   string `json:"account_id,omitempty"`
+	AccountName string `json:"account_name,omitempty"`
+	Description string `json:"description"`
+	// HourlyCommitment is the commitment to purchase of a Savings Plans
+	// recommendation.
+	HourlyCommitment        float64 `json:"hourly_commitment,omitempty"`
+	EstimatedMonthlySavings float64 `json:"estimated_monthly_savings"`
+}
+
+type CostRecommendations struct {
+	cfg       *Config
+	awsConfig *aws.Config
+	now       time.Time
+}
+
+func NewCostRecommendations(cfg *Config, awsConfig *aws.Config, now time.Time) *CostRecommendations {
+	return &CostRecommendations{cfg: cfg, awsConfig: awsConfig, now: now}
+}
+
+// GetRecommendations returns the top rightsizing and the top Savings Plans
+// purchase recommendations by estimated monthly savings. The two kinds are
+// fetched independently, since rightsizing must be enabled in Cost Explorer:
+// an error of one is logged and the other is still returned. An error is
+// returned only when both fail.
+func (r *CostRecommendations) GetRecommendations() ([]Recommendation, error) {
+	n := r.cfg.TopRecommendations
+	if n <= 0 {
+		n = DefaultTopRecommendations
+	}
+	return collectRecommendations(n, map[string]func() ([]Recommendation, error){
+		RightsizingLabel:  r.getRightsizing,
+		SavingsPlansLabel: r.getSavingsPlansPurchase,
+	})
+}
+
+// collectRecommendations returns the top n recommendations of each kind, in
+// the order of rightsizing and Savings Plans.
+func collectRecommendations(n int, getters map[string]func() ([]Recommendation, error)) ([]Recommendation, error) {
+	recommendations := []Recommendation{}
+	errs := []error{}
+	for _, kind := range []string{RightsizingLabel, SavingsPlansLabel} {
+		get, ok := getters[kind]
+		if !ok {
+			continue
+		}
+		recs, err := get()
+		if err != nil {
+			slog.Error("failed to get recommendations", "type", kind, "error", err)
+			errs = append(errs, fmt.Errorf("failed to get %s recommendations: %w", kind, err))
+			continue
+		}
+		recommendations = append(recommendations, topRecommendations(recs, n)...)
+	}
+	if len(errs) == len(getters) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return recommendations, nil
+}
+
+func (r *CostRecommendations) getRightsizing() ([]Recommendation, error) {
+	svc := costexplorer.NewFromConfig(*r.awsConfig)
+	input := &costexplorer.GetRightsizingRecommendationInput{
+		Service: aws.String("AmazonEC2"),
+	}
+	recommendations := []Recommendation{}
+	for {
+		output, err := svc.GetRightsizingRecommendation(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range output.RightsizingRecommendations {
+			recommendation, err := rightsizingRecommendation(rec)
+			if err != nil {
+				return nil, err
+			}
+			recommendations = append(recommendations, recommendation)
+		}
+		if output.NextPageToken == nil {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+	return recommendations, nil
+}
+
+// savingsPlansPurchaseInput returns the configured input, or a 1 year no
+// upfront Compute Savings Plans per linked account based on 30 days.
+func (r *CostRecommendations) savingsPlansPurchaseInput() *costexplorer.GetSavingsPlansPurchaseRecommendationInput {
+	input := costexplorer.GetSavingsPlansPurchaseRecommendationInput{
+		SavingsPlansType:     types.SupportedSavingsPlansTypeComputeSp,
+		TermInYears:          types.TermInYearsOneYear,
+		PaymentOption:        types.PaymentOptionNoUpfront,
+		LookbackPeriodInDays: types.LookbackPeriodInDaysThirtyDays,
+		AccountScope:         types.AccountScopeLinked,
+	}
+	if r.cfg.SavingsPlansPurchaseRecommendationInput != nil {
+		input = *r.cfg.SavingsPlansPurchaseRecommendationInput
+	}
+	return &input
+}
+
+func (r *CostRecommendations) getSavingsPlansPurchase() ([]Recommendation, error) {
+	svc := costexplorer.NewFromConfig(*r.awsConfig)
+	input := r.savingsPlansPurchaseInput()
+	recommendations := []Recommendation{}
+	for {
+		output, err := svc.GetSavingsPlansPurchaseRecommendation(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+		if output.SavingsPlansPurchaseRecommendation != nil {
+			recs, err := savingsPlansRecommendations(*output.SavingsPlansPurchaseRecommendation)
+			if err != nil {
+				return nil, err
+			}
+			recommendations = append(recommendations, recs...)
+		}
+		if output.NextPageToken == nil {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+	return recommendations, nil
+}
+
+func rightsizingRecommendation(rec types.RightsizingRecommendation) (Recommendation, error) {
+	recommendation := Recommendation{Type: RightsizingLabel, AccountId: aws.ToString(rec.AccountId)}
+	current := "instance"
+	if rec.CurrentInstance != nil {
+		current = aws.ToString(rec.CurrentInstance.ResourceId)
+		if t := instanceType(rec.CurrentInstance.ResourceDetails); t != "" {
+			current += " (" + t + ")"
+		}
+	}
+
+	var savings *string
+	switch rec.RightsizingType {
+	case types.RightsizingTypeTerminate:
+		recommendation.Description = "Terminate " + current
+		if rec.TerminateRecommendationDetail != nil {
+			savings = rec.TerminateRecommendationDetail.EstimatedMonthlySavings
+		}
+	default:
+		recommendation.Description = "Modify " + current
+		if rec.ModifyRecommendationDetail != nil && len(rec.ModifyRecommendationDetail.TargetInstances) > 0 {
+			target := rec.ModifyRecommendationDetail.TargetInstances[0]
+			for _, t := range rec.ModifyRecommendationDetail.TargetInstances {
+				if t.DefaultTargetInstance {
+					target = t
+					break
+				}
+			}
+			if t := instanceType(target.ResourceDetails); t != "" {
+				recommendation.Description += " to " + t
+			}
+			savings = target.EstimatedMonthlySavings
+		}
+	}
+
+	var err error
+	if recommendation.EstimatedMonthlySavings, err = parseAmount(savings); err != nil {
+		return Recommendation{}, err
+	}
+	return recommendation, nil
+}
+
+func instanceType(details *types.ResourceDetails) string {
+	if details == nil || details.EC2ResourceDetails == nil {
+		return ""
+	}
+	return aws.ToString(details.EC2ResourceDetails.InstanceType)
+}
+
+func savingsPlansRecommendations(rec types.SavingsPlansPurchaseRecommendation) ([]Recommendation, error) {
+	description := fmt.Sprintf("Purchase %s (%s, %s)",
+		savingsPlansTypeLabel(rec.SavingsPlansType),
+		strings.ToLower(strings.ReplaceAll(string(rec.TermInYears), "_", " ")),
+		strings.ToLower(strings.ReplaceAll(string(rec.PaymentOption), "_", " ")))
+	recommendations := []Recommendation{}
+	for _, detail := range rec.SavingsPlansPurchaseRecommendationDetails {
+		recommendation := Recommendation{
+			Type:        SavingsPlansLabel,
+			AccountId:   aws.ToString(detail.AccountId),
+			Description: description,
+		}
+		var err error
+		if recommendation.HourlyCommitment, err = parseAmount(detail.HourlyCommitmentToPurchase); err != nil {
+			return nil, err
+		}
+		if recommendation.EstimatedMonthlySavings, err = parseAmount(detail.EstimatedMonthlySavingsAmount); err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, recommendation)
+	}
+	return recommendations, nil
+}
+
+func savingsPlansTypeLabel(t types.SupportedSavingsPlansType) string {
+	switch t {
+	case types.SupportedSavingsPlansTypeComputeSp:
+		return "Compute Savings Plans"
+	case types.SupportedSavingsPlansTypeEc2InstanceSp:
+		return "EC2 Instance Savings Plans"
+	case types.SupportedSavingsPlansTypeSagemakerSp:
+		return "SageMaker Savings Plans"
+	default:
+		return string(t)
+	}
+}
+
+// topRecommendations returns the n recommendations with the largest
+// estimated monthly savings. Recommendations without savings are dropped.
+func topRecommendations(recommendations []Recommendation, n int) []Recommendation {
+	top := []Recommendation{}
+	for _, rec := range recommendations {
+		if rec.EstimatedMonthlySavings > 0 {
+			top = append(top, rec)
+		}
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].EstimatedMonthlySavings > top[j].EstimatedMonthlySavings
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// recommendationAccounts names the accounts of the recommendations after the
+// linked accounts of the costs.
+func recommendationAccounts(recommendations []Recommendation, costs []Cost) {
+	names := map[string]string{}
+	for _, c := range costs {
+		if c.AccountId != "" {
+			names[c.AccountId] = c.AccountName
+		}
+	}
+	for i, rec := range recommendations {
+		if name, ok := names[rec.AccountId]; ok {
+			recommendations[i].AccountName = name
+		}
+	}
+}
@@ -1,11 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"github.com/slack-go/slack"
 )
 
-func postToSlack(cfg *Config, text string, graphBuf *bytes.Buffer) error {
+func postToSlack(cfg *Config, text string, charts []Chart) error {
 	api := slack.New(cfg.SlackBotToken)
 
 	if !dryRun() {
@@ -18,16 +17,18 @@ func postToSlack(cfg *Config, text string, graphBuf *bytes.Buffer) error {
 			opts...,
 		)
 
-		_, err = api.UploadFileV2(
-			slack.UploadFileV2Parameters{
-				Reader:         graphBuf,
-				FileSize:       graphBuf.Len(),
-				Filename:       "daily_costs.png",
-				InitialComment: "アカウント別の日次料金(90日分)",
-				Channel:        cfg.SlackChannelId,
-			})
-		if err != nil {
-			return err
+		for _, chart := range charts {
+			_, err = api.UploadFileV2(
+				slack.UploadFileV2Parameters{
+					Reader:         chart.Buffer,
+					FileSize:       chart.Buffer.Len(),
+					Filename:       chart.Filename,
+					InitialComment: chart.Comment,
+					Channel:        cfg.SlackChannelId,
+				})
+			if err != nil {
+				return err
+			}
 		}
 
 		return err
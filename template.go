@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/mattn/go-runewidth"
 	"github.com/olekukonko/tablewriter"
-	"log"
+	"io"
+	"math"
+	"os"
 	"sort"
 	"strings"
 	"text/template"
@@ -12,73 +16,323 @@ import (
 )
 
 const Template = `
-{{ .Date }}の合計料金: {{ formatAmount .Total }} USD {{ .ForecastOfCurrentMonth }}
+{{ msg "total" .Date (formatCurrency .Total) .Metric }} {{ .ForecastOfCurrentMonth }}{{ if .PreviousForecast }} {{ .PreviousForecastChange }}{{ end }}{{ if .Estimated }}
+{{ msg "estimated" }}{{ end }}
 
-アカウント毎の料金:
+{{ if .GroupBy }}{{ msg "costs_by_group" .GroupBy }}{{ else }}{{ msg "costs_by_account" }}{{ end }}:
 
 {{.CodeFence}}
 {{ .CostTable }}
 {{.CodeFence}}
+{{ if .CostsByRegion }}
+{{ msg "costs_by_region" }}:
 
-上位5サービス:
+{{.CodeFence}}
+{{ .RegionTable }}
+{{.CodeFence}}
+{{ end }}{{ if .RecordTypes }}
+{{ msg "record_types" }}:
+
+{{.CodeFence}}
+{{ .RecordTypeTable }}
+{{.CodeFence}}
+{{ end }}
+{{ msg "top_services" }}:
 
 {{.CodeFence}}
 {{ .Top5ServiceTable }}
 {{.CodeFence}}
-`
+{{ if .ServiceBreakdown }}
+{{ if .GroupBy }}{{ msg "service_breakdown_group" .GroupBy }}{{ else }}{{ msg "service_breakdown" }}{{ end }}:
+
+{{.CodeFence}}
+{{ .ServiceBreakdownTable }}
+{{.CodeFence}}
+{{ end }}{{ if .Commitments }}
+{{ msg "commitments" }}:
 
-func renderText(forecasts map[string]float64, costs []Cost, periodForForecasts *types.DateInterval, period *types.DateInterval) (string, error) {
-	data, err := templateData(forecasts, costs, periodForForecasts, period)
+{{.CodeFence}}
+{{ .CommitmentTable }}
+{{.CodeFence}}
+{{ end }}{{ if .Recommendations }}
+{{ msg "recommendations" }}:
+
+{{.CodeFence}}
+{{ .RecommendationTable }}
+{{.CodeFence}}
+{{ end }}{{ if .DrillDowns }}
+{{ msg "drill_down" }}:
+
+{{.CodeFence}}
+{{ .DrillDownTable }}
+{{.CodeFence}}
+{{ end }}`
+
+// TextRenderer renders TemplateData with the default template or the one
+// configured by Template or TemplateFile.
+type TextRenderer struct {
+	tmpl     *template.Template
+	messages *Messages
+	currency *Currency
+}
+
+func NewTextRenderer(cfg *Config, messages *Messages, currency *Currency) (*TextRenderer, error) {
+	name, text, err := templateSource(cfg)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var funcMap = template.FuncMap{
-		"formatAmount": formatAmount,
+	tmpl, err := template.New(name).Funcs(templateFuncs(messages, currency)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
 	}
-	tmpl, err := template.New("").Funcs(funcMap).Parse(Template)
+
+	// Execute once against sample data so that references to unknown fields
+	// are reported at startup instead of when posting.
+	data, err := sampleTemplateData()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	data.messages = messages
+	data.currency = currency
+	if err := tmpl.Execute(io.Discard, data); err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", name, err)
 	}
+	return &TextRenderer{tmpl: tmpl, messages: messages, currency: currency}, nil
+}
 
-	b := new(strings.Builder)
-	err = tmpl.Execute(b, data)
+// sampleTemplateData returns data with every section filled, so that
+// templates indexing into the costs or ranging over optional sections can be
+// checked.
+func sampleTemplateData() (*TemplateData, error) {
+	costs := []Cost{}
+	forecasts := map[string]float64{}
+	for i := 1; i <= 5; i++ {
+		account := fmt.Sprintf("account_%d", i)
+		costs = append(costs, Cost{AccountId: fmt.Sprintf("00000000000%d", i), AccountName: account, ServiceName: fmt.Sprintf("service_%d", i), Region: "us-east-1", Amount: float64(i)})
+		forecasts[account] = float64(i * 30)
+	}
+	data, err := templateData(forecasts, costs,
+		&types.DateInterval{Start: aws.String("2022-11-01"), End: aws.String("2022-12-01")},
+		&types.DateInterval{Start: aws.String("2022-11-23"), End: aws.String("2022-11-24")})
 	if err != nil {
-		log.Fatalf("failed to render text: %v", err)
-		return "", err
+		return nil, err
+	}
+	data.Metric = UnblendedCost
+	data.PreviousForecast = &PreviousForecast{Date: "2022-11-16", Total: 400}
+	data.CostsByRegion = costsByRegion(costs)
+	data.RecordTypes = recordTypeBreakdown([]Cost{{RecordType: "Usage", Amount: 15}, {RecordType: "Tax", Amount: 1}, {RecordType: "Credit", Amount: -1}}, data.Total, false)
+	data.ServiceBreakdown = serviceBreakdown(costs, 3, 3)
+	data.Commitments = []Commitment{{Name: SavingsPlansLabel, Utilization: 90, Coverage: 50}}
+	data.Recommendations = []Recommendation{{Type: RightsizingLabel, AccountId: costs[0].AccountId, Description: "Modify instance", EstimatedMonthlySavings: 1}}
+	data.DrillDowns = []DrillDown{{ServiceName: "service_5", Amount: 5, Previous: 4, Items: []UsageCost{{UsageType: "BoxUsage", Operation: "RunInstances", Amount: 5, Previous: 4}}}}
+	return data, nil
+}
+
+func templateSource(cfg *Config) (string, string, error) {
+	if cfg.TemplateFile != "" && cfg.Template != "" {
+		return "", "", fmt.Errorf("Template and TemplateFile cannot be set at the same time")
+	}
+	if cfg.TemplateFile != "" {
+		buf, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read template file: %w", err)
+		}
+		return cfg.TemplateFile, string(buf), nil
+	}
+	if cfg.Template != "" {
+		return "Template", cfg.Template, nil
+	}
+	return "default", Template, nil
+}
+
+func (r *TextRenderer) Render(data *TemplateData) (string, error) {
+	d := *data
+	d.messages = r.messages
+	d.currency = r.currency
+	if !d.ReportDate.IsZero() {
+		d.Date = r.messages.FormatDate(d.ReportDate)
+	}
+
+	b := new(strings.Builder)
+	if err := r.tmpl.Execute(b, &d); err != nil {
+		return "", fmt.Errorf("failed to render text: %w", err)
 	}
 	return b.String(), nil
 }
 
-func formatAmount(amount float64) string {
-	return fmt.Sprintf("%.2f", amount)
+func templateFuncs(messages *Messages, currency *Currency) template.FuncMap {
+	return template.FuncMap{
+		"msg":            messages.Text,
+		"formatDate":     messages.FormatDate,
+		"monthName":      messages.MonthName,
+		"formatAmount":   currency.FormatNumber,
+		"formatCurrency": currency.Format,
+		"sortByAmount":   sortByAmount,
+		"top":            top,
+		"sum":            sum,
+		"percentChange":  percentChange,
+		"padLeft":        padLeft,
+		"padRight":       padRight,
+	}
+}
+
+// sortByAmount returns a copy of costs sorted in descending order of amount.
+func sortByAmount(costs []Cost) []Cost {
+	sorted := make([]Cost, len(costs))
+	copy(sorted, costs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Amount > sorted[j].Amount
+	})
+	return sorted
+}
+
+// top returns the first n costs. Combine with sortByAmount to get the top N.
+func top(n int, costs []Cost) []Cost {
+	if n < 0 {
+		n = 0
+	}
+	if len(costs) < n {
+		return costs
+	}
+	return costs[:n]
+}
+
+func sum(costs []Cost) float64 {
+	total := 0.0
+	for _, c := range costs {
+		total += c.Amount
+	}
+	return total
+}
+
+// percentChange returns the change from "from" to "to" in percent.
+// It returns 0 when "from" is 0.
+func percentChange(from, to float64) float64 {
+	if from == 0 {
+		return 0
+	}
+	return (to - from) / from * 100
+}
+
+func padLeft(width int, s string) string {
+	if w := runewidth.StringWidth(s); w < width {
+		return strings.Repeat(" ", width-w) + s
+	}
+	return s
+}
+
+func padRight(width int, s string) string {
+	return runewidth.FillRight(s, width)
 }
 
 type TemplateData struct {
-	Date                     string
-	Total                    float64
-	TotalForecasts           float64
-	Forecasts                map[string]float64
+	Date       string
+	ReportDate time.Time
+	Metric     string
+	// GroupBy is the tag or dimension the account table is grouped by, or
+	// empty when grouped by account.
+	GroupBy string
+	Total   float64
+	// Estimated tells that some of the costs are not finalized. Their
+	// amounts are marked in the tables.
+	Estimated      bool
+	TotalForecasts float64
+	Forecasts      map[string]float64
+	// PreviousForecast is the forecast of the same month reported a week
+	// before, or nil when the history has none.
+	PreviousForecast         *PreviousForecast
+	Costs                    []Cost
 	CostsByAccount           []Cost
 	CostsByServiceAndAccount []Cost
-	CodeFence                string
-	TargetForecastMonth      string
+	// CostsByRegion are the costs by region in descending order of amount.
+	CostsByRegion []Cost
+	// RecordTypes is the breakdown of the total by record type.
+	RecordTypes *RecordTypeBreakdown
+	// ServiceBreakdown is the top services of each of the top accounts.
+	ServiceBreakdown []AccountBreakdown
+	// Commitments are the Savings Plans and Reserved Instances.
+	Commitments []Commitment
+	// Recommendations are the rightsizing and Savings Plans purchase recommendations.
+	Recommendations []Recommendation
+	// DrillDowns are the usage types and operations of the most changed services.
+	DrillDowns          []DrillDown
+	CodeFence           string
+	TargetForecastMonth string
+	ForecastMonth       time.Month
+
+	messages *Messages
+	currency *Currency
+}
+
+func (t TemplateData) msg() *Messages {
+	if t.messages == nil {
+		return defaultMessages()
+	}
+	return t.messages
+}
+
+func (t TemplateData) groupHeader() string {
+	if t.GroupBy != "" {
+		return t.GroupBy
+	}
+	return t.msg().Text("header_account")
+}
+
+// costsByGroupTitle returns the heading of the account table.
+func (t TemplateData) costsByGroupTitle() string {
+	if t.GroupBy != "" {
+		return t.msg().Text("costs_by_group", t.GroupBy)
+	}
+	return t.msg().Text("costs_by_account")
+}
+
+// serviceBreakdownTitle returns the heading of the service breakdown table.
+func (t TemplateData) serviceBreakdownTitle() string {
+	if t.GroupBy != "" {
+		return t.msg().Text("service_breakdown_group", t.GroupBy)
+	}
+	return t.msg().Text("service_breakdown")
+}
+
+func (t TemplateData) cur() *Currency {
+	if t.currency == nil {
+		return defaultCurrency()
+	}
+	return t.currency
 }
 
 func (t TemplateData) ForecastOfCurrentMonth() string {
 	if disableForecast() {
 		return ""
 	} else if t.Forecasts == nil {
-		return fmt.Sprintf("(通知日は月末なので料金予測はありません)")
+		return t.msg().Text("forecast_unavailable")
+	} else if t.ForecastMonth == 0 {
+		return t.msg().Text("forecast", t.TargetForecastMonth, t.cur().Format(t.TotalForecasts))
 	} else {
-		return fmt.Sprintf("(%s月の料金予測: %s USD)", t.TargetForecastMonth, formatAmount(t.TotalForecasts))
+		return t.msg().Text("forecast", t.msg().MonthName(t.ForecastMonth), t.cur().Format(t.TotalForecasts))
+	}
+}
+
+// PreviousForecastChange tells how the forecast changed since the previous
+// forecast.
+func (t TemplateData) PreviousForecastChange() string {
+	if t.Forecasts == nil || t.PreviousForecast == nil {
+		return ""
+	}
+	date, err := time.Parse("2006-01-02", t.PreviousForecast.Date)
+	if err != nil {
+		return ""
 	}
+	return t.msg().Text("previous_forecast", t.msg().FormatDate(date), t.cur().Format(t.PreviousForecast.Total), t.formatChange(t.TotalForecasts-t.PreviousForecast.Total))
 }
 
 func templateData(forecasts map[string]float64, costs []Cost, periodForForecasts *types.DateInterval, period *types.DateInterval) (*TemplateData, error) {
 	var total float64 = 0
 	var totalForecast float64 = 0
 	amountsByLinkedAccount := map[string]float64{}
+	estimatedByLinkedAccount := map[string]bool{}
+	estimated := false
 
 	for _, f := range forecasts {
 		totalForecast = totalForecast + f
@@ -86,6 +340,8 @@ func templateData(forecasts map[string]float64, costs []Cost, periodForForecasts
 
 	for _, c := range costs {
 		total = total + c.Amount
+		estimated = estimated || c.Estimated
+		estimatedByLinkedAccount[c.AccountName] = estimatedByLinkedAccount[c.AccountName] || c.Estimated
 
 		if _, ok := amountsByLinkedAccount[c.AccountName]; ok {
 			amountsByLinkedAccount[c.AccountName] = amountsByLinkedAccount[c.AccountName] + c.Amount
@@ -96,7 +352,7 @@ func templateData(forecasts map[string]float64, costs []Cost, periodForForecasts
 
 	costsByAccount := []Cost{}
 	for k, v := range amountsByLinkedAccount {
-		costsByAccount = append(costsByAccount, Cost{AccountName: k, Amount: v})
+		costsByAccount = append(costsByAccount, Cost{AccountName: k, Amount: v, Estimated: estimatedByLinkedAccount[k]})
 	}
 	sort.Slice(costsByAccount, func(i, j int) bool {
 		return costsByAccount[i].Amount > costsByAccount[j].Amount
@@ -113,11 +369,19 @@ func templateData(forecasts map[string]float64, costs []Cost, periodForForecasts
 		costsByServiceAndAccount = costs
 	}
 
+	reportDate, err := time.Parse("2006-01-02", *period.Start)
+	if err != nil {
+		return nil, err
+	}
+
 	td := &TemplateData{
 		Date:                     *period.Start,
+		ReportDate:               reportDate,
 		Total:                    total,
+		Estimated:                estimated,
 		TotalForecasts:           totalForecast,
 		Forecasts:                forecasts,
+		Costs:                    costs,
 		CostsByAccount:           costsByAccount,
 		CostsByServiceAndAccount: costsByServiceAndAccount,
 		CodeFence:                "```",
@@ -128,10 +392,24 @@ func templateData(forecasts map[string]float64, costs []Cost, periodForForecasts
 			return nil, err
 		}
 		td.TargetForecastMonth = periodForForecastStart.Format("1")
+		td.ForecastMonth = periodForForecastStart.Month()
 	}
 	return td, nil
 }
 
+// EstimatedMark is appended to the amounts that are not finalized.
+const EstimatedMark = "*"
+
+// formatCost formats the amount of a cost, marking it when estimated.
+// Marked amounts are not numbers to tablewriter, so the tables align the
+// amounts explicitly.
+func (t TemplateData) formatCost(c Cost) string {
+	if c.Estimated {
+		return t.cur().FormatNumber(c.Amount) + EstimatedMark
+	}
+	return t.cur().FormatNumber(c.Amount)
+}
+
 func (t TemplateData) CostTable() string {
 	if t.Forecasts == nil {
 		return t.CostTableWithoutForecast()
@@ -143,7 +421,8 @@ func (t TemplateData) CostTable() string {
 func (t TemplateData) CostTableWithoutForecast() string {
 	buf := new(strings.Builder)
 	table := tablewriter.NewWriter(buf)
-	table.SetHeader([]string{"Account", "Cost(USD)"})
+	table.SetHeader([]string{t.groupHeader(), t.msg().Text("header_cost", t.cur().Code)})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
 	table.SetCenterSeparator("")
 	table.SetColumnSeparator("")
 	table.SetRowSeparator("")
@@ -153,7 +432,7 @@ func (t TemplateData) CostTableWithoutForecast() string {
 	for _, cost := range t.CostsByAccount {
 		data = append(data, []string{
 			cost.AccountName,
-			fmt.Sprintf("%.2f", cost.Amount),
+			t.formatCost(cost),
 		})
 	}
 	table.AppendBulk(data)
@@ -164,7 +443,8 @@ func (t TemplateData) CostTableWithoutForecast() string {
 func (t TemplateData) CostTableWithForecast() string {
 	buf := new(strings.Builder)
 	table := tablewriter.NewWriter(buf)
-	table.SetHeader([]string{"Account", "Cost(USD)", "Forecast"})
+	table.SetHeader([]string{t.groupHeader(), t.msg().Text("header_cost", t.cur().Code), t.msg().Text("header_forecast")})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
 	table.SetCenterSeparator("")
 	table.SetColumnSeparator("")
 	table.SetRowSeparator("")
@@ -174,8 +454,149 @@ func (t TemplateData) CostTableWithForecast() string {
 	for _, cost := range t.CostsByAccount {
 		data = append(data, []string{
 			cost.AccountName,
-			fmt.Sprintf("%.2f", cost.Amount),
-			fmt.Sprintf("%.2f", t.Forecasts[cost.AccountName]),
+			t.formatCost(cost),
+			t.cur().FormatNumber(t.Forecasts[cost.AccountName]),
+		})
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return buf.String()
+}
+
+// costsByRegion sums the costs by region in descending order of amount.
+// Regions without costs are dropped.
+func costsByRegion(costs []Cost) []Cost {
+	if costs == nil {
+		return nil
+	}
+	amounts := map[string]float64{}
+	estimated := map[string]bool{}
+	for _, c := range costs {
+		amounts[c.Region] += c.Amount
+		estimated[c.Region] = estimated[c.Region] || c.Estimated
+	}
+	regions := []Cost{}
+	for _, region := range sortedKeys(amounts) {
+		if amounts[region] != 0 {
+			regions = append(regions, Cost{Region: region, Amount: amounts[region], Estimated: estimated[region]})
+		}
+	}
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].Amount > regions[j].Amount
+	})
+	return regions
+}
+
+// CreditRecordTypes are the record types that reduce the costs of usage.
+var CreditRecordTypes = []string{"Credit", "Refund"}
+
+// RecordTypeBreakdown is the costs by record type, with the costs before
+// credits and refunds, the credits and refunds, and the net cost. Gross
+// includes every other record type, such as Tax, as the Gross option does.
+type RecordTypeBreakdown struct {
+	RecordTypes []Cost  `json:"record_types"`
+	Gross       float64 `json:"gross"`
+	Credits     float64 `json:"credits"`
+	Net         float64 `json:"net"`
+	// Excluded is the part of the net cost, or of the gross cost with the
+	// Gross option, that is not in the report total, such as Tax which the
+	// report excludes by default.
+	Excluded float64 `json:"excluded"`
+	// Estimated tells that some of the costs are not finalized.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// recordTypeBreakdown sums the costs by record type in descending order of
+// amount, and reconciles them with the total of the report. Record types
+// without costs are dropped.
+func recordTypeBreakdown(costs []Cost, total float64, gross bool) *RecordTypeBreakdown {
+	if costs == nil {
+		return nil
+	}
+	amounts := map[string]float64{}
+	estimated := map[string]bool{}
+	for _, c := range costs {
+		amounts[c.RecordType] += c.Amount
+		estimated[c.RecordType] = estimated[c.RecordType] || c.Estimated
+	}
+	breakdown := &RecordTypeBreakdown{RecordTypes: []Cost{}}
+	for _, recordType := range sortedKeys(amounts) {
+		amount := amounts[recordType]
+		if amount == 0 {
+			continue
+		}
+		breakdown.RecordTypes = append(breakdown.RecordTypes, Cost{RecordType: recordType, Amount: amount, Estimated: estimated[recordType]})
+		breakdown.Estimated = breakdown.Estimated || estimated[recordType]
+		breakdown.Net += amount
+		for _, credit := range CreditRecordTypes {
+			if recordType == credit {
+				breakdown.Credits += amount
+			}
+		}
+	}
+	breakdown.Gross = breakdown.Net - breakdown.Credits
+	breakdown.Excluded = breakdown.Net - total
+	if gross {
+		breakdown.Excluded = breakdown.Gross - total
+	}
+	if math.Abs(breakdown.Excluded) < 0.005 {
+		breakdown.Excluded = 0
+	}
+	sort.SliceStable(breakdown.RecordTypes, func(i, j int) bool {
+		return breakdown.RecordTypes[i].Amount > breakdown.RecordTypes[j].Amount
+	})
+	return breakdown
+}
+
+// RecordTypeTable lists the record types followed by the costs before
+// credits and refunds, the credits, the net cost and the costs not in the
+// report total.
+func (t TemplateData) RecordTypeTable() string {
+	buf := new(strings.Builder)
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{t.msg().Text("header_record_type"), t.msg().Text("header_cost", t.cur().Code)})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	data := [][]string{}
+	for _, cost := range t.RecordTypes.RecordTypes {
+		data = append(data, []string{
+			cost.RecordType,
+			t.formatCost(cost),
+		})
+	}
+	estimated := t.RecordTypes.Estimated
+	data = append(data,
+		[]string{t.msg().Text("gross"), t.formatCost(Cost{Amount: t.RecordTypes.Gross, Estimated: estimated})},
+		[]string{t.msg().Text("credits"), t.formatCost(Cost{Amount: t.RecordTypes.Credits, Estimated: estimated})},
+		[]string{t.msg().Text("net"), t.formatCost(Cost{Amount: t.RecordTypes.Net, Estimated: estimated})},
+	)
+	if t.RecordTypes.Excluded != 0 {
+		data = append(data, []string{t.msg().Text("excluded"), t.formatCost(Cost{Amount: t.RecordTypes.Excluded, Estimated: estimated})})
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return buf.String()
+}
+
+func (t TemplateData) RegionTable() string {
+	buf := new(strings.Builder)
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{t.msg().Text("header_region"), t.msg().Text("header_cost", t.cur().Code)})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	data := [][]string{}
+	for _, cost := range t.CostsByRegion {
+		data = append(data, []string{
+			cost.Region,
+			t.formatCost(cost),
 		})
 	}
 	table.AppendBulk(data)
@@ -186,7 +607,8 @@ func (t TemplateData) CostTableWithForecast() string {
 func (t TemplateData) Top5ServiceTable() string {
 	buf := new(strings.Builder)
 	table := tablewriter.NewWriter(buf)
-	table.SetHeader([]string{"Account", "Cost(USD)"})
+	table.SetHeader([]string{t.msg().Text("header_service"), t.groupHeader(), t.msg().Text("header_cost", t.cur().Code)})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
 	table.SetCenterSeparator("")
 	table.SetColumnSeparator("")
 	table.SetRowSeparator("")
@@ -197,10 +619,229 @@ func (t TemplateData) Top5ServiceTable() string {
 	for _, cost := range t.CostsByServiceAndAccount {
 		data = append(data, []string{
 			cost.ServiceName,
-			fmt.Sprintf("%.2f", cost.Amount),
+			cost.AccountName,
+			t.formatCost(cost),
+		})
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return buf.String()
+}
+
+const (
+	DefaultBreakdownAccounts = 3
+	DefaultBreakdownServices = 5
+)
+
+// AccountBreakdown is the top services of an account (or group).
+type AccountBreakdown struct {
+	AccountName string         `json:"account_name"`
+	Amount      float64        `json:"amount"`
+	Services    []ServiceShare `json:"services"`
+}
+
+// ServiceShare is the cost of a service and its share of the account total
+// in percent.
+type ServiceShare struct {
+	ServiceName string  `json:"service"`
+	Amount      float64 `json:"amount"`
+	Share       float64 `json:"share"`
+	// Estimated tells that the cost is not finalized.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// serviceBreakdown returns the top services of each of the top accounts by
+// amount.
+func serviceBreakdown(costs []Cost, accounts int, services int) []AccountBreakdown {
+	byAccount := map[string]*AccountBreakdown{}
+	amounts := map[string]map[string]float64{}
+	estimated := map[string]map[string]bool{}
+	for _, c := range costs {
+		b, ok := byAccount[c.AccountName]
+		if !ok {
+			b = &AccountBreakdown{AccountName: c.AccountName}
+			byAccount[c.AccountName] = b
+			amounts[c.AccountName] = map[string]float64{}
+			estimated[c.AccountName] = map[string]bool{}
+		}
+		b.Amount += c.Amount
+		amounts[c.AccountName][c.ServiceName] += c.Amount
+		estimated[c.AccountName][c.ServiceName] = estimated[c.AccountName][c.ServiceName] || c.Estimated
+	}
+
+	names := make([]string, 0, len(byAccount))
+	for name := range byAccount {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if byAccount[names[i]].Amount != byAccount[names[j]].Amount {
+			return byAccount[names[i]].Amount > byAccount[names[j]].Amount
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > accounts {
+		names = names[:accounts]
+	}
+
+	breakdown := []AccountBreakdown{}
+	for _, name := range names {
+		b := byAccount[name]
+		for _, service := range sortedKeys(amounts[name]) {
+			share := 0.0
+			if b.Amount != 0 {
+				share = amounts[name][service] / b.Amount * 100
+			}
+			b.Services = append(b.Services, ServiceShare{ServiceName: service, Amount: amounts[name][service], Share: share, Estimated: estimated[name][service]})
+		}
+		sort.SliceStable(b.Services, func(i, j int) bool {
+			return b.Services[i].Amount > b.Services[j].Amount
+		})
+		if len(b.Services) > services {
+			b.Services = b.Services[:services]
+		}
+		breakdown = append(breakdown, *b)
+	}
+	return breakdown
+}
+
+// formatShare formats a share in percent with one decimal place.
+func (t TemplateData) formatShare(share float64) string {
+	c := *t.cur()
+	c.Decimals = 1
+	return c.FormatNumber(share) + "%"
+}
+
+// formatChange formats a change of an amount with its sign.
+func (t TemplateData) formatChange(change float64) string {
+	if change > 0 {
+		return "+" + t.cur().FormatNumber(change)
+	}
+	return t.cur().FormatNumber(change)
+}
+
+func (t TemplateData) DrillDownTable() string {
+	buf := new(strings.Builder)
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{t.msg().Text("header_service"), t.msg().Text("header_usage_type"), t.msg().Text("header_operation"), t.msg().Text("header_cost", t.cur().Code), t.msg().Text("header_change")})
+	// Changes with a plus sign are not numbers to tablewriter, so align explicitly.
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetAutoWrapText(false)
+	table.SetBorder(false)
+	data := [][]string{}
+	for _, drillDown := range t.DrillDowns {
+		data = append(data, []string{
+			drillDown.ServiceName,
+			"",
+			"",
+			t.formatCost(Cost{Amount: drillDown.Amount, Estimated: drillDown.Estimated}),
+			t.formatChange(drillDown.Change()),
+		})
+		for _, item := range drillDown.Items {
+			data = append(data, []string{
+				"",
+				item.UsageType,
+				item.Operation,
+				t.formatCost(Cost{Amount: item.Amount, Estimated: drillDown.Estimated}),
+				t.formatChange(item.Change()),
+			})
+		}
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return buf.String()
+}
+
+func (t TemplateData) CommitmentTable() string {
+	buf := new(strings.Builder)
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{t.msg().Text("header_commitment"), t.msg().Text("header_utilization"), t.msg().Text("header_coverage"), t.msg().Text("header_on_demand", t.cur().Code), t.msg().Text("header_unused", t.cur().Code)})
+	// Percentages are not numbers to tablewriter, so align explicitly.
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetAutoWrapText(false)
+	table.SetBorder(false)
+	data := [][]string{}
+	for _, commitment := range t.Commitments {
+		data = append(data, []string{
+			commitment.Name,
+			t.formatShare(commitment.Utilization),
+			t.formatShare(commitment.Coverage),
+			t.cur().FormatNumber(commitment.OnDemandCost),
+			t.cur().FormatNumber(commitment.UnusedCost),
+		})
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return buf.String()
+}
+
+// recommendationAccount returns the account name of a recommendation, or its
+// id when the name is unknown.
+func (t TemplateData) recommendationAccount(r Recommendation) string {
+	if r.AccountName != "" {
+		return r.AccountName
+	}
+	return r.AccountId
+}
+
+func (t TemplateData) RecommendationTable() string {
+	buf := new(strings.Builder)
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{t.msg().Text("header_type"), t.msg().Text("header_account"), t.msg().Text("header_recommendation"), t.msg().Text("header_savings", t.cur().Code)})
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetAutoWrapText(false)
+	table.SetBorder(false)
+	data := [][]string{}
+	for _, rec := range t.Recommendations {
+		data = append(data, []string{
+			rec.Type,
+			t.recommendationAccount(rec),
+			rec.Description,
+			t.cur().FormatNumber(rec.EstimatedMonthlySavings),
 		})
 	}
 	table.AppendBulk(data)
 	table.Render()
 	return buf.String()
 }
+
+func (t TemplateData) ServiceBreakdownTable() string {
+	buf := new(strings.Builder)
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{t.groupHeader(), t.msg().Text("header_service"), t.msg().Text("header_cost", t.cur().Code), t.msg().Text("header_share")})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetAutoWrapText(false)
+	table.SetBorder(false)
+	data := [][]string{}
+	for _, account := range t.ServiceBreakdown {
+		for i, service := range account.Services {
+			name := ""
+			if i == 0 {
+				name = account.AccountName
+			}
+			data = append(data, []string{
+				name,
+				service.ServiceName,
+				t.formatCost(Cost{Amount: service.Amount, Estimated: service.Estimated}),
+				t.formatShare(service.Share),
+			})
+		}
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return buf.String()
+}